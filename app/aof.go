@@ -0,0 +1,421 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AppendFsyncAlways   = "always"
+	AppendFsyncEverysec = "everysec"
+	AppendFsyncNo       = "no"
+)
+
+const aofCronInterval = 100 * time.Millisecond
+
+var ErrAofRewriteInProgress = fmt.Errorf("ERR Background append only file rewriting already in progress")
+
+/**
+ * the multi part append only file: every executed write command is appended, in RESP form,
+ * to the current incr file of the manifest in dir
+ */
+type appendOnlyFile struct {
+	mu       sync.Mutex
+	dir      string
+	prefix   string
+	manifest *aofManifest
+	file     *os.File
+	// bytes appended since the last fsync, only tracked for everysec
+	unsynced bool
+
+	rewriteInProgress bool
+	lastRewriteOK     bool
+	// size of all the files, and that size right after the last rewrite (or load) for auto rewrite growth
+	currentSize int64
+	baseSize    int64
+}
+
+// nil while appendonly is off
+var aof *appendOnlyFile
+
+func aofDirPath() string {
+	dir, exists := GetFlagValue(FlagDir)
+	if !exists {
+		dir = "."
+	}
+	dirName, _ := getConfig(ConfigAppendDirname)
+	return filepath.Join(dir, dirName)
+}
+
+func aofFsyncPolicy() string {
+	policy, _ := getConfig(ConfigAppendFsync)
+	return strings.ToLower(policy)
+}
+
+func (a *appendOnlyFile) manifestPath() string {
+	return filepath.Join(a.dir, a.prefix+".manifest")
+}
+
+func (a *appendOnlyFile) path(info aofFileInfo) string {
+	return filepath.Join(a.dir, info.Name)
+}
+
+/**
+ * open the AOF in dir: read its manifest, or start a new one adopting a single file AOF left in the parent
+ * directory as its base. appending starts once it is loaded, see openForAppend
+ */
+func openAppendOnlyFile(dir, prefix string) (*appendOnlyFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	a := &appendOnlyFile{dir: dir, prefix: prefix, lastRewriteOK: true}
+	manifest, err := readAofManifest(a.manifestPath())
+	if os.IsNotExist(err) {
+		manifest = &aofManifest{}
+		legacy := filepath.Join(filepath.Dir(dir), prefix)
+		if _, statErr := os.Stat(legacy); statErr == nil {
+			log.Printf("upgrading the single file AOF %s to a multi part AOF", legacy)
+			if err := os.Rename(legacy, filepath.Join(dir, prefix)); err != nil {
+				return nil, err
+			}
+			manifest.base = &aofFileInfo{Name: prefix, Seq: 1, Type: aofFileTypeBase}
+			manifest.baseSeq = 1
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	a.manifest = manifest
+
+	for _, info := range manifest.files() {
+		if stat, err := os.Stat(a.path(info)); err == nil {
+			a.currentSize += stat.Size()
+		}
+	}
+	a.baseSize = a.currentSize
+	return a, nil
+}
+
+/** continue appending to the last incr file, creating the first one if there is none*/
+func (a *appendOnlyFile) openForAppend() error {
+	if len(a.manifest.incrs) == 0 {
+		return a.openNewIncr()
+	}
+
+	last := a.manifest.incrs[len(a.manifest.incrs)-1]
+	file, err := os.OpenFile(a.path(last), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	a.file = file
+	return nil
+}
+
+/** switch appends to a new incr file and record it in the manifest. caller holds mu, or owns a*/
+func (a *appendOnlyFile) openNewIncr() error {
+	info := a.manifest.nextIncr(a.prefix)
+	file, err := os.OpenFile(a.path(info), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	a.manifest.incrs = append(a.manifest.incrs, info)
+	if err := a.manifest.persist(a.manifestPath()); err != nil {
+		a.manifest.incrs = a.manifest.incrs[:len(a.manifest.incrs)-1]
+		file.Close()
+		os.Remove(a.path(info))
+		return err
+	}
+
+	if a.file != nil {
+		a.file.Sync()
+		a.file.Close()
+	}
+	a.file = file
+	a.unsynced = false
+	return nil
+}
+
+/** append a command. with appendfsync always it is on disk before this returns*/
+func (a *appendOnlyFile) Append(command RESPValue) error {
+	data, err := command.Serialize()
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(data); err != nil {
+		return err
+	}
+	a.currentSize += int64(len(data))
+
+	switch aofFsyncPolicy() {
+	case AppendFsyncAlways:
+		return a.file.Sync()
+	case AppendFsyncEverysec:
+		a.unsynced = true
+	}
+	return nil
+}
+
+/**
+ * BGREWRITEAOF: new writes go to a new incr file right away, while the key space as of that moment is written
+ * as an RDB base file in the background. once it is written the manifest is switched to the new base followed
+ * by the incr files opened since, and the files it replaces are deleted
+ */
+func (a *appendOnlyFile) StartRewrite() error {
+	// the cut must not fall between applying a write and appending it, or the write would end up both in the
+	// base and in the new incr file and be applied twice on load
+	writeCommandMu.Lock()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.rewriteInProgress {
+		writeCommandMu.Unlock()
+		return ErrAofRewriteInProgress
+	}
+	err := a.openNewIncr()
+	firstKeptIncr := len(a.manifest.incrs) - 1
+	var snapshot map[string]Entry
+	if err == nil {
+		snapshot = store.Snapshot()
+	}
+	writeCommandMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	base := a.manifest.nextBase(a.prefix)
+	a.rewriteInProgress = true
+
+	go func() {
+		err := writeRDBFile(a.path(base), snapshot)
+
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.rewriteInProgress = false
+		if err == nil {
+			err = a.installRewrite(base, firstKeptIncr)
+		}
+		a.lastRewriteOK = err == nil
+		if err != nil {
+			log.Printf("background AOF rewrite failed: %v", err)
+			os.Remove(a.path(base))
+			return
+		}
+		log.Println("background AOF rewrite finished successfully")
+	}()
+	return nil
+}
+
+/** replace the base and the incr files before firstKeptIncr with the rewritten base. caller holds mu*/
+func (a *appendOnlyFile) installRewrite(base aofFileInfo, firstKeptIncr int) error {
+	replaced := a.manifest.incrs[:firstKeptIncr]
+	if a.manifest.base != nil {
+		replaced = append([]aofFileInfo{*a.manifest.base}, replaced...)
+	}
+
+	previousBase, previousIncrs := a.manifest.base, a.manifest.incrs
+	a.manifest.base = &base
+	a.manifest.incrs = append([]aofFileInfo(nil), a.manifest.incrs[firstKeptIncr:]...)
+	if err := a.manifest.persist(a.manifestPath()); err != nil {
+		a.manifest.base, a.manifest.incrs = previousBase, previousIncrs
+		return err
+	}
+
+	for _, info := range replaced {
+		if err := os.Remove(a.path(info)); err != nil {
+			log.Printf("failed removing the rewritten AOF file %s: %v", info.Name, err)
+		}
+	}
+
+	a.currentSize = 0
+	for _, info := range a.manifest.files() {
+		if stat, err := os.Stat(a.path(info)); err == nil {
+			a.currentSize += stat.Size()
+		}
+	}
+	a.baseSize = a.currentSize
+	return nil
+}
+
+/** whether the AOF grew enough since the last rewrite for auto-aof-rewrite-percentage/min-size*/
+func (a *appendOnlyFile) shouldAutoRewrite(percentage, minSize int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.rewriteInProgress || percentage <= 0 || a.currentSize < minSize {
+		return false
+	}
+	base := max(a.baseSize, 1)
+	growth := (a.currentSize - base) * 100 / base
+	return growth >= percentage
+}
+
+/** fsync appends for everysec once a second, and start a rewrite when the AOF grew past the auto rewrite thresholds*/
+func (a *appendOnlyFile) startCron() {
+	go func() {
+		ticker := time.NewTicker(aofCronInterval)
+		defer ticker.Stop()
+
+		lastSync := time.Now()
+		for now := range ticker.C {
+			if now.Sub(lastSync) >= time.Second {
+				lastSync = now
+				a.syncIfNeeded()
+			}
+
+			percentage := getIntConfig(ConfigAutoAofRewritePercentage)
+			rawMinSize, _ := getConfig(ConfigAutoAofRewriteMinSize)
+			minSize, _ := parseMemorySize(rawMinSize)
+			if a.shouldAutoRewrite(percentage, minSize) {
+				log.Println("starting automatic AOF rewrite")
+				if err := a.StartRewrite(); err != nil {
+					log.Printf("automatic AOF rewrite failed to start: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (a *appendOnlyFile) syncIfNeeded() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.unsynced {
+		if err := a.file.Sync(); err != nil {
+			log.Printf("AOF fsync failed: %v", err)
+		}
+		a.unsynced = false
+	}
+}
+
+func (a *appendOnlyFile) RewriteInProgress() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rewriteInProgress
+}
+
+func (a *appendOnlyFile) LastRewriteOK() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lastRewriteOK
+}
+
+func (a *appendOnlyFile) Sizes() (current, base int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.currentSize, a.baseSize
+}
+
+/** replay every file of the manifest into the store, only the last one may be truncated*/
+func (a *appendOnlyFile) load() error {
+	files := a.manifest.files()
+	for i, info := range files {
+		path := a.path(info)
+		var err error
+		if strings.HasSuffix(info.Name, ".rdb") {
+			err = loadRDBBase(path)
+		} else {
+			err = loadAppendOnlyFile(path, i == len(files)-1)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("%s: %w", info.Name, err)
+		}
+	}
+	return nil
+}
+
+func loadRDBBase(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return parseRDB(file, store)
+}
+
+/**
+ * replay an AOF file into the store by executing every command in it.
+ * when it is the last file, a file cut in the middle of its last command (e.g. after a crash) is truncated to
+ * its last complete command if aof-load-truncated is yes. any other corruption fails the load
+ */
+func loadAppendOnlyFile(path string, isLast bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := NewTrackingBufReader(file)
+	validBytes := 0
+	commands := 0
+	for {
+		val, err := parseRESPValue(reader)
+		if err != nil {
+			if err == io.EOF && reader.bytesRead == validBytes {
+				break
+			}
+			if isLast && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+				return handleTruncatedAppendOnlyFile(path, validBytes)
+			}
+			return fmt.Errorf("bad file format reading the append only file at offset %d: %w", validBytes, err)
+		}
+		if val.Type != Array {
+			return fmt.Errorf("bad file format reading the append only file at offset %d: expected an array", validBytes)
+		}
+
+		cmd, err := ParseRESPCommandFromArray(val.Array)
+		if err != nil {
+			return fmt.Errorf("unknown command in the append only file at offset %d: %w", validBytes, err)
+		}
+		// only writes that succeeded are appended, an error means the file doesn't describe our dataset
+		if reply := cmd.Execute(CommandContext{}); reply.Type == Error {
+			return fmt.Errorf("%s in the append only file at offset %d failed: %s", cmd.Name(), validBytes, reply.String)
+		}
+
+		validBytes = reader.bytesRead
+		commands++
+	}
+
+	log.Printf("AOF loaded %d commands from %s", commands, path)
+	return nil
+}
+
+func handleTruncatedAppendOnlyFile(path string, validBytes int) error {
+	if !getBoolConfig(ConfigAofLoadTruncated) {
+		return fmt.Errorf("unexpected end of file reading the append only file %s, set aof-load-truncated to yes to load it anyway", path)
+	}
+
+	log.Printf("!!! Warning: short read while loading the AOF file %s, truncating it to %d bytes", path, validBytes)
+	return os.Truncate(path, int64(validBytes))
+}
+
+/** load the AOF when appendonly is on (it is the source of truth then, any RDB is ignored) and start appending to it*/
+func initAppendOnlyFile() error {
+	if !getBoolConfig(ConfigAppendOnly) {
+		return nil
+	}
+
+	prefix, _ := getConfig(ConfigAppendFilename)
+	file, err := openAppendOnlyFile(aofDirPath(), prefix)
+	if err != nil {
+		return err
+	}
+	if err := file.load(); err != nil {
+		return err
+	}
+	if err := file.openForAppend(); err != nil {
+		return err
+	}
+
+	file.startCron()
+	aof = file
+	return nil
+}
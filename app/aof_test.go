@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func respCommands(t *testing.T, commands ...[]string) []byte {
+	var data []byte
+	for _, command := range commands {
+		serialized, err := RESPValue{Type: Array, Array: bulkArgs(command...)}.Serialize()
+		assert.NoError(t, err)
+		data = append(data, serialized...)
+	}
+	return data
+}
+
+func writeTestAOF(t *testing.T, commands ...[]string) string {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	assert.NoError(t, os.WriteFile(path, respCommands(t, commands...), 0644))
+	return path
+}
+
+func TestLoadAppendOnlyFile(t *testing.T) {
+	ResetStore()
+	path := writeTestAOF(t,
+		[]string{"SET", "a", "1"},
+		[]string{"SET", "a", "2"},
+		[]string{"XADD", "s", "5-1", "f", "v"},
+	)
+
+	assert.NoError(t, loadAppendOnlyFile(path, true))
+
+	entry, status := store.Get("a", StringEntryType)
+	assert.Equal(t, Found, status)
+	assert.Equal(t, "2", entry.Val)
+	_, status = store.Get("s", StreamEntryType)
+	assert.Equal(t, Found, status)
+}
+
+func TestLoadAppendOnlyFile_TruncatedTail(t *testing.T) {
+	defer delete(configOverrides, ConfigAofLoadTruncated)
+
+	path := writeTestAOF(t, []string{"SET", "a", "1"})
+	complete, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	assert.NoError(t, err)
+	_, err = file.WriteString("*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$5\r\nhel")
+	assert.NoError(t, err)
+	file.Close()
+
+	assert.NoError(t, setConfig(ConfigAofLoadTruncated, "no"))
+	ResetStore()
+	assert.Error(t, loadAppendOnlyFile(path, true))
+
+	// only the last file of the manifest may be truncated
+	assert.NoError(t, setConfig(ConfigAofLoadTruncated, "yes"))
+	ResetStore()
+	assert.Error(t, loadAppendOnlyFile(path, false))
+
+	ResetStore()
+	assert.NoError(t, loadAppendOnlyFile(path, true))
+
+	_, status := store.Get("a", StringEntryType)
+	assert.Equal(t, Found, status)
+	_, status = store.Get("b", StringEntryType)
+	assert.Equal(t, NotFound, status)
+
+	truncated, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, complete.Size(), truncated.Size())
+}
+
+func TestLoadAppendOnlyFile_Corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	assert.NoError(t, os.WriteFile(path, []byte("*1\r\n$4\r\nPING\r\ngarbage"), 0644))
+
+	ResetStore()
+	assert.Error(t, loadAppendOnlyFile(path, true))
+}
+
+func TestLoadAppendOnlyFile_FailedCommand(t *testing.T) {
+	path := writeTestAOF(t,
+		[]string{"XADD", "s", "5-1", "f", "v"},
+		[]string{"XADD", "s", "1-1", "f", "v"},
+	)
+
+	ResetStore()
+	err := loadAppendOnlyFile(path, true)
+	assert.ErrorContains(t, err, "XADD in the append only file at offset 44 failed")
+}
+
+func TestAofManifest_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof.manifest")
+	manifest := &aofManifest{}
+	base := manifest.nextBase("appendonly.aof")
+	manifest.base = &base
+	manifest.incrs = append(manifest.incrs, manifest.nextIncr("appendonly.aof"), manifest.nextIncr("appendonly.aof"))
+	assert.NoError(t, manifest.persist(path))
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file appendonly.aof.1.base.rdb seq 1 type b\n"+
+		"file appendonly.aof.1.incr.aof seq 1 type i\n"+
+		"file appendonly.aof.2.incr.aof seq 2 type i\n", string(content))
+
+	loaded, err := readAofManifest(path)
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, loaded)
+}
+
+func openTestAOF(t *testing.T, dir string) *appendOnlyFile {
+	a, err := openAppendOnlyFile(dir, "appendonly.aof")
+	assert.NoError(t, err)
+	assert.NoError(t, a.load())
+	assert.NoError(t, a.openForAppend())
+	t.Cleanup(func() { a.file.Close() })
+	return a
+}
+
+func TestAppendOnlyFile_Rewrite(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "appendonlydir")
+	ResetStore()
+	a := openTestAOF(t, dir)
+
+	for _, command := range [][]string{{"SET", "a", "1"}, {"SET", "a", "2"}, {"SET", "b", "1"}} {
+		NewSetCommand(bulkArgs(command...)).Execute(CommandContext{})
+		assert.NoError(t, a.Append(RESPValue{Type: Array, Array: bulkArgs(command...)}))
+	}
+
+	assert.NoError(t, a.StartRewrite())
+	assert.Equal(t, ErrAofRewriteInProgress, a.StartRewrite())
+	// a write landing while the base is being written
+	NewSetCommand(bulkArgs("SET", "c", "1")).Execute(CommandContext{})
+	assert.NoError(t, a.Append(RESPValue{Type: Array, Array: bulkArgs("SET", "c", "1")}))
+	assert.Eventually(t, func() bool { return !a.RewriteInProgress() }, time.Second, 5*time.Millisecond)
+	assert.True(t, a.LastRewriteOK())
+
+	manifest, err := readAofManifest(a.manifestPath())
+	assert.NoError(t, err)
+	assert.Equal(t, "appendonly.aof.1.base.rdb", manifest.base.Name)
+	assert.Equal(t, []aofFileInfo{{Name: "appendonly.aof.2.incr.aof", Seq: 2, Type: aofFileTypeIncr}}, manifest.incrs)
+	_, err = os.Stat(filepath.Join(dir, "appendonly.aof.1.incr.aof"))
+	assert.True(t, os.IsNotExist(err))
+
+	ResetStore()
+	openTestAOF(t, dir)
+	for key, value := range map[string]string{"a": "2", "b": "1", "c": "1"} {
+		entry, status := store.Get(key, StringEntryType)
+		assert.Equal(t, Found, status, key)
+		assert.Equal(t, value, entry.Val, key)
+	}
+}
+
+func TestAppendOnlyFile_RewriteDuringWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "appendonlydir")
+	ResetStore()
+	aof = openTestAOF(t, dir)
+	defer func() { aof = nil }()
+
+	const clients, writes = 4, 200
+	var wg sync.WaitGroup
+	for c := 0; c < clients; c++ {
+		server, client := net.Pipe()
+		go handleConnection(server)
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			defer client.Close()
+			reader := NewTrackingBufReader(client)
+			for i := 1; i <= writes; i++ {
+				data, _ := RESPValue{Type: Array, Array: bulkArgs("XADD", key, fmt.Sprintf("%d-1", i), "f", "v")}.Serialize()
+				client.Write(data)
+				reply, err := parseRESPValue(reader)
+				assert.NoError(t, err)
+				assert.NotEqual(t, Error, reply.Type, reply.String)
+			}
+		}(fmt.Sprintf("s%d", c))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for rewriting := true; rewriting; {
+		select {
+		case <-done:
+			rewriting = false
+		default:
+		}
+		if err := aof.StartRewrite(); err != ErrAofRewriteInProgress {
+			assert.NoError(t, err)
+		}
+	}
+	assert.Eventually(t, func() bool { return !aof.RewriteInProgress() }, time.Second, time.Millisecond)
+
+	// every write is either in the base or in an incr file, never in both
+	ResetStore()
+	openTestAOF(t, dir)
+	for c := 0; c < clients; c++ {
+		s, err := getStream(fmt.Sprintf("s%d", c))
+		assert.NoError(t, err)
+		assert.Equal(t, writes, s.Len())
+	}
+}
+
+func TestAppendOnlyFile_RewriteWaitsForAppliedWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "appendonlydir")
+	ResetStore()
+	aof = openTestAOF(t, dir)
+	defer func() { aof = nil }()
+
+	// a write that was applied but not appended yet, the way handleConnection runs it
+	command := RESPValue{Type: Array, Array: bulkArgs("XADD", "s", "1-1", "f", "v")}
+	cmd, err := ParseRESPCommandFromArray(command.Array)
+	assert.NoError(t, err)
+	var commandContext CommandContext
+	release := acquireWriteLock(true, &commandContext)
+	cmd.Execute(commandContext)
+
+	started := make(chan error)
+	go func() { started <- aof.StartRewrite() }()
+	select {
+	case <-started:
+		t.Fatal("the rewrite cut the AOF between applying a write and appending it")
+	case <-time.After(50 * time.Millisecond):
+	}
+	recordWrite(command)
+	release()
+	assert.NoError(t, <-started)
+	assert.Eventually(t, func() bool { return !aof.RewriteInProgress() }, time.Second, time.Millisecond)
+
+	ResetStore()
+	openTestAOF(t, dir)
+	s, err := getStream("s")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestAppendOnlyFile_UpgradesSingleFile(t *testing.T) {
+	parent := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(parent, "appendonly.aof"), respCommands(t, []string{"SET", "k", "v"}), 0644))
+
+	ResetStore()
+	a := openTestAOF(t, filepath.Join(parent, "appendonlydir"))
+
+	_, status := store.Get("k", StringEntryType)
+	assert.Equal(t, Found, status)
+	assert.Equal(t, &aofFileInfo{Name: "appendonly.aof", Seq: 1, Type: aofFileTypeBase}, a.manifest.base)
+	assert.Len(t, a.manifest.incrs, 1)
+}
+
+func TestAppendOnlyFile_ShouldAutoRewrite(t *testing.T) {
+	a := &appendOnlyFile{baseSize: 100, currentSize: 150}
+	assert.False(t, a.shouldAutoRewrite(100, 0))
+	a.currentSize = 200
+	assert.True(t, a.shouldAutoRewrite(100, 0))
+	assert.False(t, a.shouldAutoRewrite(100, 1000), "below min size")
+	assert.False(t, a.shouldAutoRewrite(0, 0), "disabled")
+}
+
+func TestParseMemorySize(t *testing.T) {
+	for input, want := range map[string]int64{"1024": 1024, "64mb": 64 << 20, "1GB": 1 << 30, "2k": 2000} {
+		got, err := parseMemorySize(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	_, err := parseMemorySize("lots")
+	assert.Error(t, err)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// file types in the manifest, as redis names them
+const (
+	aofFileTypeBase    = "b"
+	aofFileTypeIncr    = "i"
+	aofFileTypeHistory = "h"
+)
+
+type aofFileInfo struct {
+	Name string
+	Seq  int64
+	Type string
+}
+
+/**
+ * the multi part AOF manifest, compatible with redis 7: a base file holding a snapshot
+ * followed by the incremental files with every write since, replayed in order.
+ * https://github.com/redis/redis/blob/unstable/src/aof.c
+ */
+type aofManifest struct {
+	base    *aofFileInfo
+	incrs   []aofFileInfo
+	baseSeq int64
+	incrSeq int64
+}
+
+func (info aofFileInfo) line() string {
+	return fmt.Sprintf("file %s seq %d type %s\n", info.Name, info.Seq, info.Type)
+}
+
+/** parse a manifest, every line holds `file <name> seq <seq> type <b|i|h>` pairs in any order*/
+func readAofManifest(path string) (*aofManifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := &aofManifest{}
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 {
+			return nil, fmt.Errorf("invalid AOF manifest line %d: %q", lineNum, line)
+		}
+		var info aofFileInfo
+		for i := 0; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "file":
+				info.Name = fields[i+1]
+			case "seq":
+				if info.Seq, err = strconv.ParseInt(fields[i+1], 10, 64); err != nil {
+					return nil, fmt.Errorf("invalid AOF manifest line %d: %q", lineNum, line)
+				}
+			case "type":
+				info.Type = fields[i+1]
+			}
+		}
+		if info.Name == "" || strings.ContainsAny(info.Name, "/\\") {
+			return nil, fmt.Errorf("invalid AOF file name in manifest line %d: %q", lineNum, line)
+		}
+
+		switch info.Type {
+		case aofFileTypeBase:
+			if manifest.base != nil {
+				return nil, fmt.Errorf("AOF manifest has more than one base file")
+			}
+			manifest.base = &info
+			manifest.baseSeq = info.Seq
+		case aofFileTypeIncr:
+			if info.Seq <= manifest.incrSeq {
+				return nil, fmt.Errorf("AOF manifest incr files are out of order at line %d", lineNum)
+			}
+			manifest.incrs = append(manifest.incrs, info)
+			manifest.incrSeq = info.Seq
+		case aofFileTypeHistory:
+			// left over from an interrupted rewrite, no longer part of the dataset
+		default:
+			return nil, fmt.Errorf("invalid AOF file type in manifest line %d: %q", lineNum, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+/** write the manifest to a temp file and rename it into place*/
+func (manifest *aofManifest) persist(path string) error {
+	var builder strings.Builder
+	if manifest.base != nil {
+		builder.WriteString(manifest.base.line())
+	}
+	for _, incr := range manifest.incrs {
+		builder.WriteString(incr.line())
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "temp-manifest-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	_, err = tmp.WriteString(builder.String())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+/** all the files the dataset is made of, in replay order*/
+func (manifest *aofManifest) files() []aofFileInfo {
+	var files []aofFileInfo
+	if manifest.base != nil {
+		files = append(files, *manifest.base)
+	}
+	return append(files, manifest.incrs...)
+}
+
+func (manifest *aofManifest) nextIncr(prefix string) aofFileInfo {
+	manifest.incrSeq++
+	return aofFileInfo{
+		Name: fmt.Sprintf("%s.%d.incr.aof", prefix, manifest.incrSeq),
+		Seq:  manifest.incrSeq,
+		Type: aofFileTypeIncr,
+	}
+}
+
+func (manifest *aofManifest) nextBase(prefix string) aofFileInfo {
+	manifest.baseSeq++
+	return aofFileInfo{
+		Name: fmt.Sprintf("%s.%d.base.rdb", prefix, manifest.baseSeq),
+		Seq:  manifest.baseSeq,
+		Type: aofFileTypeBase,
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+/**
+ * circular buffer holding the most recently propagated bytes of the replication stream,
+ * so a replica that reconnects can be sent only what it missed (PSYNC +CONTINUE)
+ */
+type replicationBacklog struct {
+	buf []byte
+	// next write position in buf
+	idx int
+	// number of valid bytes held, at most len(buf)
+	histlen int
+	// master_repl_offset: total number of bytes ever fed
+	offset int64
+}
+
+func newReplicationBacklog(size int, offset int64) *replicationBacklog {
+	return &replicationBacklog{buf: make([]byte, size), offset: offset}
+}
+
+func (b *replicationBacklog) feed(data []byte) {
+	b.offset += int64(len(data))
+
+	// only the tail can survive when data is larger than the whole buffer
+	if len(data) > len(b.buf) {
+		data = data[len(data)-len(b.buf):]
+	}
+	for len(data) > 0 {
+		n := copy(b.buf[b.idx:], data)
+		b.idx = (b.idx + n) % len(b.buf)
+		b.histlen = min(b.histlen+n, len(b.buf))
+		data = data[n:]
+	}
+}
+
+/** offset of the first byte held, in the 1 based PSYNC offset space*/
+func (b *replicationBacklog) firstOffset() int64 {
+	return b.offset - int64(b.histlen) + 1
+}
+
+/**
+ * the bytes a replica that asked for psyncOffset (its own offset + 1) is missing.
+ * ok is false when they are no longer, or never were, in the backlog
+ */
+func (b *replicationBacklog) readFrom(psyncOffset int64) (data []byte, ok bool) {
+	first := b.firstOffset()
+	if psyncOffset < first || psyncOffset > b.offset+1 {
+		return nil, false
+	}
+
+	skip := int(psyncOffset - first)
+	length := b.histlen - skip
+	data = make([]byte, 0, length)
+	start := (b.idx - b.histlen + skip + len(b.buf)) % len(b.buf)
+	if start+length <= len(b.buf) {
+		return append(data, b.buf[start:start+length]...), true
+	}
+	data = append(data, b.buf[start:]...)
+	return append(data, b.buf[:length-(len(b.buf)-start)]...), true
+}
+
+/** a backlog of a new size holding as much of the current history as fits*/
+func (b *replicationBacklog) resized(size int) *replicationBacklog {
+	resized := newReplicationBacklog(size, b.offset-int64(min(b.histlen, size)))
+	if tail, ok := b.readFrom(resized.offset + 1); ok {
+		resized.feed(tail)
+	}
+	return resized
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationBacklog(t *testing.T) {
+	b := newReplicationBacklog(8, 0)
+	b.feed([]byte("abcde"))
+	assert.Equal(t, int64(5), b.offset)
+
+	data, ok := b.readFrom(1)
+	assert.True(t, ok)
+	assert.Equal(t, "abcde", string(data))
+	data, ok = b.readFrom(6)
+	assert.True(t, ok, "an up to date replica misses nothing")
+	assert.Empty(t, data)
+	_, ok = b.readFrom(7)
+	assert.False(t, ok, "ahead of the master")
+
+	// wraps around, the first 4 bytes are gone
+	b.feed([]byte("fghijkl"))
+	assert.Equal(t, int64(12), b.offset)
+	_, ok = b.readFrom(4)
+	assert.False(t, ok)
+	data, ok = b.readFrom(5)
+	assert.True(t, ok)
+	assert.Equal(t, "efghijkl", string(data))
+	data, ok = b.readFrom(10)
+	assert.True(t, ok)
+	assert.Equal(t, "jkl", string(data))
+
+	// larger than the whole buffer
+	b.feed([]byte("0123456789"))
+	data, ok = b.readFrom(b.firstOffset())
+	assert.True(t, ok)
+	assert.Equal(t, "23456789", string(data))
+
+	smaller := b.resized(3)
+	assert.Equal(t, b.offset, smaller.offset)
+	data, ok = smaller.readFrom(smaller.firstOffset())
+	assert.True(t, ok)
+	assert.Equal(t, "789", string(data))
+}
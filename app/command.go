@@ -1,16 +1,15 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"io"
 	"log"
 	"net"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
 )
 
 const (
@@ -26,6 +25,30 @@ const (
 	CommandWAIT   = "WAIT"
 	CommandTYPE   = "TYPE"
 	CommandXADD   = "XADD"
+	CommandXRANGE = "XRANGE"
+	CommandXREV   = "XREVRANGE"
+	CommandXREAD  = "XREAD"
+
+	CommandXGROUP     = "XGROUP"
+	CommandXREADGROUP = "XREADGROUP"
+	CommandXACK       = "XACK"
+	CommandXPENDING   = "XPENDING"
+	CommandXCLAIM     = "XCLAIM"
+	CommandXAUTOCLAIM = "XAUTOCLAIM"
+	CommandXTRIM      = "XTRIM"
+	CommandXDEL       = "XDEL"
+	CommandXLEN       = "XLEN"
+	CommandXINFO      = "XINFO"
+
+	CommandSAVE     = "SAVE"
+	CommandBGSAVE   = "BGSAVE"
+	CommandLASTSAVE = "LASTSAVE"
+
+	CommandBGREWRITEAOF = "BGREWRITEAOF"
+
+	CommandREPLICAOF = "REPLICAOF"
+	CommandSLAVEOF   = "SLAVEOF"
+	CommandROLE      = "ROLE"
 )
 
 type RESPCommand interface {
@@ -34,6 +57,10 @@ type RESPCommand interface {
 	Execute(context CommandContext) RESPValue
 }
 
+const ErrWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+const ErrReadOnlyReplica = "READONLY You can't write against a read only replica."
+const ErrNoReplicas = "NOREPLICAS Not enough good replicas to write."
+
 type PingCommand struct {
 	values []RESPValue
 }
@@ -66,6 +93,9 @@ func (e *EchoCommand) Execute(context CommandContext) RESPValue {
 type SetCommand struct {
 	BaseWriteCommand
 	values []RESPValue
+	// absolute expiry of a successful SET with PX, nil if it had none
+	resolvedExpireAt *int64
+	executed         bool
 }
 
 func (s *SetCommand) Name() string      { return CommandSET }
@@ -80,13 +110,22 @@ func (s *SetCommand) Execute(context CommandContext) RESPValue {
 	value := s.values[2].String
 	var expireAt *int64 = nil
 
-	if len(s.values) >= 5 && strings.ToUpper(s.values[3].String) == "PX" {
-		ttlMillis, err := strconv.Atoi(s.values[4].String)
-		if err != nil || ttlMillis < 0 {
-			return RESPValue{Type: Error, String: "ERR PX value must be a non-negative integer"}
+	if len(s.values) >= 5 {
+		switch strings.ToUpper(s.values[3].String) {
+		case "PX":
+			ttlMillis, err := strconv.Atoi(s.values[4].String)
+			if err != nil || ttlMillis < 0 {
+				return RESPValue{Type: Error, String: "ERR PX value must be a non-negative integer"}
+			}
+			exp := time.Now().UnixMilli() + int64(ttlMillis)
+			expireAt = &exp
+		case "PXAT":
+			exp, err := strconv.ParseInt(s.values[4].String, 10, 64)
+			if err != nil || exp < 0 {
+				return RESPValue{Type: Error, String: "ERR PXAT value must be a non-negative integer"}
+			}
+			expireAt = &exp
 		}
-		exp := time.Now().UnixMilli() + int64(ttlMillis)
-		expireAt = &exp
 	}
 
 	log.Printf("setting key: %s, value: %s", key, value)
@@ -96,6 +135,8 @@ func (s *SetCommand) Execute(context CommandContext) RESPValue {
 		Type:     StringEntryType,
 	})
 
+	s.executed = true
+	s.resolvedExpireAt = expireAt
 	return RESPValue{Type: SimpleString, String: "OK"}
 }
 
@@ -137,19 +178,33 @@ func (c *ConfigCommand) Execute(context CommandContext) RESPValue {
 		return RESPValue{Type: Error, String: "ERR wrong number of arguments for CONFIG GET"}
 	}
 
-	argName := c.values[2]
+	switch strings.ToUpper(c.values[1].String) {
+	case "SET":
+		if len(c.values) != 4 {
+			return RESPValue{Type: Error, String: "ERR wrong number of arguments for CONFIG SET"}
+		}
+		if err := setConfig(c.values[2].String, c.values[3].String); err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		return RESPValue{Type: SimpleString, String: "OK"}
 
-	argValue, exists := GetFlagValue(argName.String)
+	case "GET":
+		argName := c.values[2]
 
-	if !exists {
-		return RESPValue{Type: Array, Array: []RESPValue{}}
-	}
+		argValue, exists := getConfig(argName.String)
+
+		if !exists {
+			return RESPValue{Type: Array, Array: []RESPValue{}}
+		}
 
-	var responseArr []RESPValue
-	responseArr = append(responseArr, RESPValue{Type: BulkString, String: argName.String})
-	responseArr = append(responseArr, RESPValue{Type: BulkString, String: argValue})
+		var responseArr []RESPValue
+		responseArr = append(responseArr, RESPValue{Type: BulkString, String: argName.String})
+		responseArr = append(responseArr, RESPValue{Type: BulkString, String: argValue})
 
-	return RESPValue{Type: Array, Array: responseArr}
+		return RESPValue{Type: Array, Array: responseArr}
+	}
+
+	return RESPValue{Type: Error, String: fmt.Sprintf("ERR unknown subcommand '%s'", c.values[1].String)}
 }
 
 type KeysCommand struct {
@@ -195,6 +250,7 @@ func (i *InfoCommand) Execute(context CommandContext) RESPValue {
 	var stringBuilder strings.Builder
 	for _, section := range sections {
 		stringBuilder.Write([]byte(section.GetInfo()))
+		stringBuilder.WriteString("\n\n")
 	}
 
 	return RESPValue{Type: BulkString, String: strings.TrimSpace(stringBuilder.String())}
@@ -258,6 +314,16 @@ func (r *ReplConfCommand) Execute(context CommandContext) RESPValue {
 		key := strings.ToLower(args[i].String)
 		value := args[i+1].String
 		log.Printf("REPLCONF: %s = %s\n", key, value)
+
+		if key == "listening-port" {
+			port, err := strconv.Atoi(value)
+			if err != nil || port < 0 || port > 65535 {
+				return RESPValue{Type: Error, String: "ERR value is not an integer or out of range"}
+			}
+			if context.client != nil {
+				context.client.replicaListeningPort = port
+			}
+		}
 	}
 
 	return RESPValue{Type: SimpleString, String: "OK"}
@@ -265,6 +331,8 @@ func (r *ReplConfCommand) Execute(context CommandContext) RESPValue {
 
 type PsyncCommand struct {
 	values []RESPValue
+	// decided while answering, carried out after the reply was written. nil when PSYNC was rejected
+	pending *replicaSync
 }
 
 func (*PsyncCommand) Name() string        { return CommandPSYNC }
@@ -277,15 +345,20 @@ func (p *PsyncCommand) Execute(context CommandContext) RESPValue {
 	}
 
 	replicationID := args[0].String
-	offset := args[1].String
+	offset, err := strconv.ParseInt(args[1].String, 10, 64)
+	if err != nil {
+		return RESPValue{Type: Error, String: "ERR value is not an integer or out of range"}
+	}
 
-	log.Printf("PSYNC received: replicationID=%s, offset=%s\n", replicationID, offset)
+	log.Printf("PSYNC received: replicationID=%s, offset=%d\n", replicationID, offset)
 
-	// Hardcoded full resync response
-	return RESPValue{
-		Type:   SimpleString,
-		String: fmt.Sprintf("FULLRESYNC %s %d", GetMasterReplId(), 0),
+	listeningPort := 0
+	if context.client != nil {
+		listeningPort = context.client.replicaListeningPort
 	}
+	response, pending := beginReplicaSync(context.Conn, listeningPort, replicationID, offset)
+	p.pending = &pending
+	return response
 }
 
 type WaitCommand struct {
@@ -318,45 +391,41 @@ func (w *WaitCommand) Execute(ctx CommandContext) RESPValue {
 		return RESPValue{Type: Error, String: "ERR invalid timeout"}
 	}
 
-	deadline := time.Now().Add(time.Duration(timeoutMs) * time.Millisecond)
-	ticker := time.NewTicker(10 * time.Millisecond)
-	defer ticker.Stop()
+	// what this client wrote must be acknowledged, writes of other clients do not matter
+	var target int64
+	if ctx.client != nil {
+		target = ctx.client.lastWriteOffset
+	}
 
-	for {
-		acked := 0
-		for _, replicateState := range GetAllConnectedReplicas() {
-			if !replicateState.NeedsAck() {
-				log.Println("[WAIT] acked command for replica: ", replicateState.Addr)
-				acked++
-				continue
-			}
-			// Still needs ACK — trigger GETACK
-			go func(repicaState *ReplicaState) {
-				if err := repicaState.SendAck(100 * time.Millisecond); err != nil {
-					log.Printf("[WAIT] retry ack failed: %v", err)
-				} else {
-					log.Printf("expected bytes: %d, actual bytes: %d", repicaState.PendingOffset, repicaState.LastAckOffset)
-				}
-			}(replicateState)
-		}
+	notified := ackNotification()
+	acked, total := countReplicasAckedAt(target)
+	if acked >= numReplicas || acked == total {
+		// enough replicas already, or nothing pending on any of them
+		return RESPValue{Type: Integer, Integer: int64(acked)}
+	}
 
-		if acked >= numReplicas {
-			log.Println("[WAIT]acked number of request replicas: ", numReplicas)
-			return RESPValue{
-				Type:    Integer,
-				Integer: int64(acked),
-			}
-		}
+	// a zero timeout blocks until enough replicas acknowledged
+	var timeout <-chan time.Time
+	if timeoutMs > 0 {
+		timer := time.NewTimer(time.Duration(timeoutMs) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
-		if time.Now().After(deadline) {
-			log.Printf("[WAIT]time out of: %s has reached, acked %d out of %d", deadline, acked, numReplicas)
-			return RESPValue{
-				Type:    Integer,
-				Integer: int64(acked),
-			}
+	requestReplicaAcks()
+	for {
+		select {
+		case <-notified:
+		case <-timeout:
+			acked, _ = countReplicasAckedAt(target)
+			log.Printf("[WAIT] timed out, acked %d out of %d", acked, numReplicas)
+			return RESPValue{Type: Integer, Integer: int64(acked)}
 		}
 
-		<-ticker.C
+		notified = ackNotification()
+		if acked, _ = countReplicasAckedAt(target); acked >= numReplicas {
+			return RESPValue{Type: Integer, Integer: int64(acked)}
+		}
 	}
 }
 
@@ -386,7 +455,11 @@ func (t *TypeCommand) Execute(ctx CommandContext) RESPValue {
 }
 
 type XAddCommand struct {
+	BaseWriteCommand
 	values []RESPValue
+	// index in values of the id argument and the id it resolved to, set once the entry was added
+	idArgIdx   int
+	resolvedID string
 }
 
 func (xAdd *XAddCommand) Name() string {
@@ -397,40 +470,305 @@ func (xAdd *XAddCommand) Args() []RESPValue {
 	return xAdd.values[1:]
 }
 
+/** XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] id field value [field value ...]*/
 func (xAdd *XAddCommand) Execute(ctx CommandContext) RESPValue {
 	args := xAdd.Args()
 
 	if len(args) < 4 {
-		return RESPValue{Type: Error, String: "invalid number of arguments for 'xadd' command"}
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xadd' command"}
+	}
+
+	streamKey := args[0].String
+	noMkStream := false
+	var trimOpts *stream.TrimOptions
+
+	i := 1
+options:
+	for i < len(args) {
+		switch strings.ToUpper(args[i].String) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			opts, next, err := parseTrimOptions(args, i)
+			if err != nil {
+				return RESPValue{Type: Error, String: err.Error()}
+			}
+			trimOpts = &opts
+			i = next
+		default:
+			break options
+		}
+	}
+
+	if len(args)-i < 3 || (len(args)-i)%2 != 1 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xadd' command"}
+	}
+	rawEntryId := args[i].String
+	fields := ConvertToStreamFields(args[i+1:])
+
+	var s *stream.Stream
+	var created bool
+	var err error
+	if noMkStream {
+		s, err = getStream(streamKey)
+		if err == nil && s == nil {
+			return RESPValue{Type: BulkString, IsNil: true}
+		}
+	} else {
+		s, created, err = getOrCreateStream(streamKey)
+	}
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+
+	id, err := s.Add(rawEntryId, fields)
+	if err != nil {
+		// a rejected XADD must not leave an empty stream behind, but the key may hold something else by now
+		if created && s.Len() == 0 {
+			store.CompareAndDelete(streamKey, s)
+		}
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+
+	if trimOpts != nil {
+		s.Trim(*trimOpts)
+	}
+
+	// i is relative to Args, which skips the command name
+	xAdd.idArgIdx = i + 1
+	xAdd.resolvedID = id.String()
+	streamWaiters.signal(streamKey)
+	return RESPValue{Type: BulkString, String: xAdd.resolvedID}
+}
+
+func (xAdd *XAddCommand) ShouldReplicate() bool {
+	return xAdd.resolvedID != ""
+}
+
+/** replicas must store the entry under the id the master generated, never generate their own*/
+func (xAdd *XAddCommand) PropagatedValues(original RESPValue) []RESPValue {
+	values := make([]RESPValue, len(xAdd.values))
+	copy(values, xAdd.values)
+	values[xAdd.idArgIdx] = RESPValue{Type: BulkString, String: xAdd.resolvedID}
+	return []RESPValue{{Type: Array, Array: values}}
+}
+
+type XRangeCommand struct {
+	values  []RESPValue
+	reverse bool
+}
+
+func (xRange *XRangeCommand) Name() string {
+	if xRange.reverse {
+		return CommandXREV
+	}
+	return CommandXRANGE
+}
+
+func (xRange *XRangeCommand) Args() []RESPValue {
+	return xRange.values[1:]
+}
+
+func (xRange *XRangeCommand) Execute(ctx CommandContext) RESPValue {
+	args := xRange.Args()
+	if len(args) != 3 && len(args) != 5 {
+		return RESPValue{Type: Error, String: fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(xRange.Name()))}
+	}
+
+	// XREVRANGE takes the boundaries as <end> <start>
+	rawStart, rawEnd := args[1].String, args[2].String
+	if xRange.reverse {
+		rawStart, rawEnd = rawEnd, rawStart
+	}
+
+	start, err := parseIntervalID(rawStart, 0, true)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	end, err := parseIntervalID(rawEnd, stream.MaxID.Sequence, false)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+
+	count := 0
+	if len(args) == 5 {
+		if strings.ToUpper(args[3].String) != "COUNT" {
+			return RESPValue{Type: Error, String: "ERR syntax error"}
+		}
+		count, err = strconv.Atoi(args[4].String)
+		if err != nil {
+			return RESPValue{Type: Error, String: "ERR value is not an integer or out of range"}
+		}
+		if count <= 0 {
+			return RESPValue{Type: Array, Array: []RESPValue{}}
+		}
+	}
+
+	s, err := getStream(args[0].String)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Array, Array: []RESPValue{}}
 	}
 
-	// enriesMap, err := ConvertToFieldsMap(args[2:])
-	// if err != nil {
-	// 	log.Println("invalid key values arguments for 'xadd' command")
-	// 	return RESPValue{Type: Error, String: "invalid number of arguments for 'xadd' command"}
-	// }
+	return streamEntriesToRESP(s.Range(start, end, count, xRange.reverse))
+}
 
-	// streamKey := args[0].String
-	// entryId := args[1].String
+type XReadCommand struct {
+	values []RESPValue
+}
 
-	// ExecuteStreamEntryInsertion()
+func (xRead *XReadCommand) Name() string {
+	return CommandXREAD
+}
 
-	return RESPValue{}
+func (xRead *XReadCommand) Args() []RESPValue {
+	return xRead.values[1:]
 }
 
-func ConvertToFieldsMap(args []RESPValue) (map[string]string, error) {
-	if (len(args)-2)%2 != 0 {
-		return nil, fmt.Errorf("invliad number of arguments for conversion of args to a map")
+func (xRead *XReadCommand) Execute(ctx CommandContext) RESPValue {
+	opts, err := parseStreamReadOptions(xRead.Args(), false)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+
+	// register before resolving "$" so no entry added in between can be missed
+	var waiter *streamWaiter
+	if opts.block >= 0 {
+		waiter = streamWaiters.register(opts.keys...)
+		defer streamWaiters.unregister(waiter)
 	}
 
-	fields := make(map[string]string, len(args)/2)
-	for i := 2; i < len(args); i += 2 {
-		field := args[i].String
-		value := args[i+1].String
-		fields[field] = value
+	lastIDs := make([]stream.StreamID, len(opts.keys))
+	for i, key := range opts.keys {
+		id, err := resolveXReadID(key, opts.ids[i])
+		if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		lastIDs[i] = id
 	}
 
-	return fields, nil
+	return waitForStreams(ctx.writeLock, waiter, opts.block, func() ([]RESPValue, error) {
+		return readStreamsAfter(opts.keys, lastIDs, opts.count)
+	})
+}
+
+type XTrimCommand struct {
+	BaseWriteCommand
+	values  []RESPValue
+	trimmed int64
+}
+
+func (xTrim *XTrimCommand) Name() string      { return CommandXTRIM }
+func (xTrim *XTrimCommand) Args() []RESPValue { return xTrim.values[1:] }
+
+/** XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]*/
+func (xTrim *XTrimCommand) Execute(ctx CommandContext) RESPValue {
+	args := xTrim.Args()
+	if len(args) < 3 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xtrim' command"}
+	}
+
+	opts, next, err := parseTrimOptions(args, 1)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if next != len(args) {
+		return RESPValue{Type: Error, String: "ERR syntax error"}
+	}
+
+	s, err := getStream(args[0].String)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Integer, Integer: 0}
+	}
+
+	xTrim.trimmed = s.Trim(opts)
+	return RESPValue{Type: Integer, Integer: xTrim.trimmed}
+}
+
+/** a trim that removed nothing leaves the stream as it was*/
+func (xTrim *XTrimCommand) ShouldReplicate() bool {
+	return xTrim.trimmed > 0
+}
+
+type XDelCommand struct {
+	BaseWriteCommand
+	values  []RESPValue
+	deleted int64
+}
+
+func (xDel *XDelCommand) Name() string      { return CommandXDEL }
+func (xDel *XDelCommand) Args() []RESPValue { return xDel.values[1:] }
+
+func (xDel *XDelCommand) Execute(ctx CommandContext) RESPValue {
+	args := xDel.Args()
+	if len(args) < 2 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xdel' command"}
+	}
+
+	ids := make([]stream.StreamID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := parseStrictStreamID(arg.String)
+		if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		ids = append(ids, id)
+	}
+
+	s, err := getStream(args[0].String)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Integer, Integer: 0}
+	}
+
+	xDel.deleted = s.Delete(ids)
+	return RESPValue{Type: Integer, Integer: xDel.deleted}
+}
+
+/** only ids that existed change the stream*/
+func (xDel *XDelCommand) ShouldReplicate() bool {
+	return xDel.deleted > 0
+}
+
+type XLenCommand struct {
+	values []RESPValue
+}
+
+func (xLen *XLenCommand) Name() string      { return CommandXLEN }
+func (xLen *XLenCommand) Args() []RESPValue { return xLen.values[1:] }
+
+func (xLen *XLenCommand) Execute(ctx CommandContext) RESPValue {
+	args := xLen.Args()
+	if len(args) != 1 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xlen' command"}
+	}
+
+	s, err := getStream(args[0].String)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Integer, Integer: 0}
+	}
+
+	return RESPValue{Type: Integer, Integer: int64(s.Len())}
+}
+
+/** convert a flat list of field value arguments to stream fields, keeping their order*/
+func ConvertToStreamFields(args []RESPValue) []stream.StreamField {
+	fields := make([]stream.StreamField, 0, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		fields = append(fields, stream.StreamField{Name: args[i].String, Value: args[i+1].String})
+	}
+
+	return fields
 }
 
 type CommandFactory func([]RESPValue) RESPCommand
@@ -448,6 +786,26 @@ func init() {
 	commandRegistry[CommandWAIT] = NewCommandWait
 	commandRegistry[CommandTYPE] = NewTypeCommand
 	commandRegistry[CommandXADD] = NewXddCommand
+	commandRegistry[CommandXRANGE] = NewXRangeCommand
+	commandRegistry[CommandXREV] = NewXRevRangeCommand
+	commandRegistry[CommandXREAD] = NewXReadCommand
+	commandRegistry[CommandXGROUP] = NewXGroupCommand
+	commandRegistry[CommandXREADGROUP] = NewXReadGroupCommand
+	commandRegistry[CommandXACK] = NewXAckCommand
+	commandRegistry[CommandXPENDING] = NewXPendingCommand
+	commandRegistry[CommandXCLAIM] = NewXClaimCommand
+	commandRegistry[CommandXAUTOCLAIM] = NewXAutoClaimCommand
+	commandRegistry[CommandXTRIM] = NewXTrimCommand
+	commandRegistry[CommandXDEL] = NewXDelCommand
+	commandRegistry[CommandXLEN] = NewXLenCommand
+	commandRegistry[CommandXINFO] = NewXInfoCommand
+	commandRegistry[CommandSAVE] = NewSaveCommand
+	commandRegistry[CommandBGSAVE] = NewBgSaveCommand
+	commandRegistry[CommandLASTSAVE] = NewLastSaveCommand
+	commandRegistry[CommandBGREWRITEAOF] = NewBgRewriteAofCommand
+	commandRegistry[CommandREPLICAOF] = NewReplicaOfCommand
+	commandRegistry[CommandSLAVEOF] = NewReplicaOfCommand
+	commandRegistry[CommandROLE] = NewRoleCommand
 }
 
 var commandRegistry = map[string]CommandFactory{}
@@ -517,91 +875,100 @@ func NewXddCommand(values []RESPValue) RESPCommand {
 	return &XAddCommand{values: values}
 }
 
-/**if any Post command action is required, the command can imlement this interface*/
-type PostCommandExecuteAction interface {
-	HandlePostWrite(conn net.Conn) error
+func NewXRangeCommand(values []RESPValue) RESPCommand {
+	return &XRangeCommand{values: values}
 }
 
-func (*PsyncCommand) KeepsConnectionAlive() bool {
-	return true
+func NewXRevRangeCommand(values []RESPValue) RESPCommand {
+	return &XRangeCommand{values: values, reverse: true}
 }
 
-func (p *PsyncCommand) HandlePostWrite(conn net.Conn) error {
-	err := streamRdbFileToReplica(conn)
-	if err != nil {
-		log.Printf("failed streaming rdb file to replica: %v", err)
-		return err
-	}
+func NewXReadCommand(values []RESPValue) RESPCommand {
+	return &XReadCommand{values: values}
+}
 
-	log.Println("register a replica")
-	registerReplica(conn)
-	return nil
+func NewXGroupCommand(values []RESPValue) RESPCommand {
+	return &XGroupCommand{values: values}
 }
 
-func streamRdbFileToReplica(conn net.Conn) error {
-	rdbPath := getRDBPath()
-	log.Println("open init rdb file from: ", rdbPath)
+func NewXReadGroupCommand(values []RESPValue) RESPCommand {
+	return &XReadGroupCommand{values: values}
+}
 
-	var rdbReader io.Reader
-	var rdbSize int64
+func NewXAckCommand(values []RESPValue) RESPCommand {
+	return &XAckCommand{values: values}
+}
 
-	file, err := os.Open(rdbPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// File doesn't exist — generate minimal empty RDB on the fly
-			log.Println("RDB file does not exist. Generating empty RDB.")
-			emptyRDB := generateEmptyRDB()
-			rdbReader = bytes.NewReader(emptyRDB)
-			rdbSize = int64(len(emptyRDB))
-		} else {
-			log.Printf("Failed to open RDB file: %v", err)
-			return err
-		}
-	} else {
-		defer file.Close()
-		info, err := file.Stat()
-		if err != nil {
-			log.Printf("Failed to stat RDB file: %v", err)
-			return err
-		}
-		rdbReader = file
-		rdbSize = info.Size()
-	}
+func NewXPendingCommand(values []RESPValue) RESPCommand {
+	return &XPendingCommand{values: values}
+}
 
-	// Send RESP bulk string header
-	header := fmt.Sprintf("$%d\r\n", rdbSize)
-	if _, err := conn.Write([]byte(header)); err != nil {
-		log.Printf("Failed to send RDB header: %v", err)
-		return err
-	}
+func NewXClaimCommand(values []RESPValue) RESPCommand {
+	return &XClaimCommand{values: values}
+}
 
-	// Stream the RDB content
-	if _, err := io.Copy(conn, rdbReader); err != nil {
-		log.Printf("Failed to stream RDB content: %v", err)
-		return err
-	}
-	return nil
+func NewXAutoClaimCommand(values []RESPValue) RESPCommand {
+	return &XAutoClaimCommand{values: values}
 }
 
-func generateEmptyRDB() []byte {
-	var buf bytes.Buffer
-	buf.WriteString("REDIS0012")
-	buf.WriteByte(0xFF)
-	buf.Write(make([]byte, 8))
+func NewXTrimCommand(values []RESPValue) RESPCommand {
+	return &XTrimCommand{values: values}
+}
 
-	return buf.Bytes()
+func NewXDelCommand(values []RESPValue) RESPCommand {
+	return &XDelCommand{values: values}
 }
 
-func getRDBPath() string {
-	exePath, err := os.Executable()
-	if err != nil {
-		log.Fatalf("Failed to get executable path: %v", err)
+func NewXLenCommand(values []RESPValue) RESPCommand {
+	return &XLenCommand{values: values}
+}
+
+func NewXInfoCommand(values []RESPValue) RESPCommand {
+	return &XInfoCommand{values: values}
+}
+
+func NewSaveCommand(values []RESPValue) RESPCommand {
+	return &SaveCommand{values: values}
+}
+
+func NewBgSaveCommand(values []RESPValue) RESPCommand {
+	return &BgSaveCommand{values: values}
+}
+
+func NewLastSaveCommand(values []RESPValue) RESPCommand {
+	return &LastSaveCommand{values: values}
+}
+
+func NewBgRewriteAofCommand(values []RESPValue) RESPCommand {
+	return &BgRewriteAofCommand{values: values}
+}
+
+func NewReplicaOfCommand(values []RESPValue) RESPCommand {
+	return &ReplicaOfCommand{values: values}
+}
+
+func NewRoleCommand(values []RESPValue) RESPCommand {
+	return &RoleCommand{values: values}
+}
+
+/**if any Post command action is required, the command can imlement this interface*/
+type PostCommandExecuteAction interface {
+	HandlePostWrite(conn net.Conn) error
+}
+
+func (*PsyncCommand) KeepsConnectionAlive() bool {
+	return true
+}
+
+func (p *PsyncCommand) HandlePostWrite(conn net.Conn) error {
+	if p.pending == nil {
+		return nil
+	}
+	if err := p.pending.complete(conn); err != nil {
+		log.Printf("resync with replica failed: %v", err)
+		return err
 	}
-	exeDir := filepath.Dir(exePath)
-	rdbPath := filepath.Join(exeDir, "..", "data", "empty.rdb")
-	rdbPath = filepath.Clean(rdbPath)
-	log.Printf("getRDBPath() -> exe = %q, resolved = %q", exePath, rdbPath)
-	return rdbPath
+	return nil
 }
 
 type WriteCommand interface {
@@ -609,8 +976,43 @@ type WriteCommand interface {
 	ShouldReplicate() bool
 }
 
+/**
+ * a write command whose effect depends on when or where it runs (generated ids, relative expiries, idle times)
+ * can implement this interface to propagate a deterministic version of itself instead of what the client sent.
+ * the version may take several commands, they are propagated in order
+ */
+type PropagationRewriter interface {
+	PropagatedValues(original RESPValue) []RESPValue
+}
+
+/** the RESP values that should be propagated for an executed write command*/
+func propagatedValues(cmd RESPCommand, original RESPValue) []RESPValue {
+	if rewriter, ok := cmd.(PropagationRewriter); ok {
+		return rewriter.PropagatedValues(original)
+	}
+	return []RESPValue{original}
+}
+
 func (s *SetCommand) ShouldReplicate() bool {
-	return true
+	return s.executed
+}
+
+/** a relative expiry is propagated as an absolute PXAT, so replicas expire the key at the same time*/
+func (s *SetCommand) PropagatedValues(original RESPValue) []RESPValue {
+	if s.resolvedExpireAt == nil {
+		return []RESPValue{original}
+	}
+
+	return []RESPValue{{
+		Type: Array,
+		Array: []RESPValue{
+			{Type: BulkString, String: CommandSET},
+			s.values[1],
+			s.values[2],
+			{Type: BulkString, String: "PXAT"},
+			{Type: BulkString, String: strconv.FormatInt(*s.resolvedExpireAt, 10)},
+		},
+	}}
 }
 
 func (r *ReplConfCommand) ShouldResponseBackToMaster() bool {
@@ -620,6 +1022,17 @@ func (r *ReplConfCommand) ShouldResponseBackToMaster() bool {
 type CommandContext struct {
 	Conn         net.Conn
 	replicaStats *ReplicaTrackingBytes
+	client       *ClientState
+	// held while a write command runs, nil for other commands. see writeCommandMu
+	writeLock sync.Locker
+}
+
+/** state kept per client connection across its commands*/
+type ClientState struct {
+	// the master offset right after this client's last propagated write, what WAIT waits for
+	lastWriteOffset int64
+	// set by REPLCONF listening-port when the client is a replica about to PSYNC
+	replicaListeningPort int
 }
 
 type BaseWriteCommand struct{}
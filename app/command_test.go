@@ -2,11 +2,13 @@ package main
 
 import (
 	"fmt"
-	"os"
+	"net"
+	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -171,17 +173,16 @@ func TestSetGetCommands_ThreadSafety(t *testing.T) {
 
 func TestConfigCommand(t *testing.T) {
 	ResetStore()
-	originalArgs := os.Args
-	defer func() { os.Args = originalArgs }()
+	defer parseFlags(nil)
 
 	const (
 		TEST_DIR     = "/tmp/test-dir"
 		DB_FILE_NAME = "test.rdb"
 	)
 
-	os.Args = []string{
+	parseFlags([]string{
 		"your_program", FlagDir, TEST_DIR, FlagDbFilename, DB_FILE_NAME,
-	}
+	})
 
 	tests := []struct {
 		name          string
@@ -209,3 +210,386 @@ func TestConfigCommand(t *testing.T) {
 		})
 	}
 }
+
+func xAdd(key, id string, fieldValues ...string) RESPValue {
+	values := []RESPValue{
+		{Type: BulkString, String: CommandXADD},
+		{Type: BulkString, String: key},
+		{Type: BulkString, String: id},
+	}
+	for _, fv := range fieldValues {
+		values = append(values, RESPValue{Type: BulkString, String: fv})
+	}
+	return NewXddCommand(values).Execute(CommandContext{})
+}
+
+func TestXAddCommand_ExplicitIDs(t *testing.T) {
+	ResetStore()
+
+	resp := xAdd("events", "1-1", "temp", "36")
+	assert.Equal(t, RESPValue{Type: BulkString, String: "1-1"}, resp)
+
+	resp = xAdd("events", "1-2", "temp", "37")
+	assert.Equal(t, "1-2", resp.String)
+
+	resp = xAdd("events", "1-2", "temp", "38")
+	assert.Equal(t, Error, resp.Type)
+	assert.Equal(t, "ERR The ID specified in XADD is equal or smaller than the target stream top item", resp.String)
+
+	resp = xAdd("events", "0-1", "temp", "38")
+	assert.Equal(t, "ERR The ID specified in XADD is equal or smaller than the target stream top item", resp.String)
+
+	typeResp := NewTypeCommand([]RESPValue{
+		{Type: BulkString, String: CommandTYPE},
+		{Type: BulkString, String: "events"},
+	}).Execute(CommandContext{})
+	assert.Equal(t, "stream", typeResp.String)
+}
+
+func TestXAddCommand_ZeroID(t *testing.T) {
+	ResetStore()
+
+	resp := xAdd("events", "0-0", "a", "b")
+	assert.Equal(t, Error, resp.Type)
+	assert.Equal(t, "ERR The ID specified in XADD must be greater than 0-0", resp.String)
+
+	_, lookupStatus := store.Get("events", AnyEntryType)
+	assert.Equal(t, NotFound, lookupStatus)
+}
+
+func TestXAddCommand_AutoSequence(t *testing.T) {
+	ResetStore()
+
+	assert.Equal(t, "0-1", xAdd("events", "0-*", "a", "b").String)
+	assert.Equal(t, "0-2", xAdd("events", "0-*", "a", "b").String)
+	assert.Equal(t, "5-0", xAdd("events", "5-*", "a", "b").String)
+	assert.Equal(t, "5-1", xAdd("events", "5-*", "a", "b").String)
+	assert.Equal(t, Error, xAdd("events", "4-*", "a", "b").Type)
+}
+
+func TestXAddCommand_AutoID(t *testing.T) {
+	ResetStore()
+
+	first := xAdd("events", "*", "a", "b")
+	second := xAdd("events", "*", "a", "b")
+	assert.Equal(t, BulkString, first.Type)
+	assert.Equal(t, BulkString, second.Type)
+
+	firstID, _, err := stream.ParseStreamID(first.String)
+	assert.NoError(t, err)
+	secondID, _, err := stream.ParseStreamID(second.String)
+	assert.NoError(t, err)
+	assert.True(t, firstID.LessThan(secondID))
+}
+
+func TestXAddCommand_WrongType(t *testing.T) {
+	ResetStore()
+	store.Set("str", Entry{Val: "v", Type: StringEntryType})
+
+	resp := xAdd("str", "1-1", "a", "b")
+	assert.Equal(t, ErrWrongType, resp.String)
+}
+
+func bulkArgs(args ...string) []RESPValue {
+	values := make([]RESPValue, 0, len(args))
+	for _, arg := range args {
+		values = append(values, RESPValue{Type: BulkString, String: arg})
+	}
+	return values
+}
+
+func entryIDs(resp RESPValue) []string {
+	var ids []string
+	for _, entry := range resp.Array {
+		ids = append(ids, entry.Array[0].String)
+	}
+	return ids
+}
+
+func TestXRangeCommand(t *testing.T) {
+	ResetStore()
+	for _, id := range []string{"9-0", "10-0", "10-1", "11-5"} {
+		xAdd("events", id, "id", id)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"full range", []string{"events", "-", "+"}, []string{"9-0", "10-0", "10-1", "11-5"}},
+		{"incomplete ids", []string{"events", "10", "10"}, []string{"10-0", "10-1"}},
+		{"exclusive start", []string{"events", "(10-0", "+"}, []string{"10-1", "11-5"}},
+		{"exclusive end", []string{"events", "-", "(10-1"}, []string{"9-0", "10-0"}},
+		{"count", []string{"events", "-", "+", "COUNT", "2"}, []string{"9-0", "10-0"}},
+		{"missing key", []string{"missing", "-", "+"}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := NewXRangeCommand(bulkArgs(append([]string{CommandXRANGE}, test.args...)...)).Execute(CommandContext{})
+			assert.Equal(t, Array, resp.Type)
+			assert.Equal(t, test.want, entryIDs(resp))
+		})
+	}
+}
+
+func TestXRangeCommand_EntryFields(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-1", "b", "2", "a", "1")
+
+	resp := NewXRangeCommand(bulkArgs(CommandXRANGE, "events", "-", "+")).Execute(CommandContext{})
+	want := RESPValue{Type: Array, Array: []RESPValue{
+		{Type: Array, Array: []RESPValue{
+			{Type: BulkString, String: "1-1"},
+			{Type: Array, Array: bulkArgs("b", "2", "a", "1")},
+		}},
+	}}
+	assert.True(t, EqualRESPValue(want, resp))
+}
+
+func TestXRevRangeCommand(t *testing.T) {
+	ResetStore()
+	for _, id := range []string{"9-0", "10-0", "10-1", "11-5"} {
+		xAdd("events", id, "id", id)
+	}
+
+	resp := NewXRevRangeCommand(bulkArgs(CommandXREV, "events", "+", "-", "COUNT", "3")).Execute(CommandContext{})
+	assert.Equal(t, []string{"11-5", "10-1", "10-0"}, entryIDs(resp))
+
+	resp = NewXRevRangeCommand(bulkArgs(CommandXREV, "events", "(11-5", "10")).Execute(CommandContext{})
+	assert.Equal(t, []string{"10-1", "10-0"}, entryIDs(resp))
+}
+
+func TestXReadCommand_MultipleStreams(t *testing.T) {
+	ResetStore()
+	xAdd("a", "1-1", "f", "1")
+	xAdd("a", "1-2", "f", "2")
+	xAdd("b", "5-0", "f", "3")
+
+	resp := NewXReadCommand(bulkArgs(CommandXREAD, "COUNT", "1", "STREAMS", "a", "b", "1-1", "0")).Execute(CommandContext{})
+	assert.Equal(t, Array, resp.Type)
+	assert.Len(t, resp.Array, 2)
+	assert.Equal(t, "a", resp.Array[0].Array[0].String)
+	assert.Equal(t, []string{"1-2"}, entryIDs(resp.Array[0].Array[1]))
+	assert.Equal(t, "b", resp.Array[1].Array[0].String)
+	assert.Equal(t, []string{"5-0"}, entryIDs(resp.Array[1].Array[1]))
+
+	resp = NewXReadCommand(bulkArgs(CommandXREAD, "STREAMS", "a", "b")).Execute(CommandContext{})
+	assert.Equal(t, Error, resp.Type)
+}
+
+func TestXReadCommand_BlockTimeout(t *testing.T) {
+	ResetStore()
+	xAdd("a", "1-1", "f", "1")
+
+	start := time.Now()
+	resp := NewXReadCommand(bulkArgs(CommandXREAD, "BLOCK", "50", "STREAMS", "a", "$")).Execute(CommandContext{})
+	assert.Equal(t, Array, resp.Type)
+	assert.Nil(t, resp.Array)
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestXReadCommand_BlockWokenByXAdd(t *testing.T) {
+	ResetStore()
+	xAdd("a", "1-1", "f", "1")
+
+	for _, timeout := range []string{"0", "5000"} {
+		t.Run("BLOCK "+timeout, func(t *testing.T) {
+			result := make(chan RESPValue)
+			go func() {
+				result <- NewXReadCommand(bulkArgs(CommandXREAD, "BLOCK", timeout, "STREAMS", "a", "$")).Execute(CommandContext{})
+			}()
+
+			time.Sleep(20 * time.Millisecond)
+			added := xAdd("a", "*", "f", "2")
+
+			select {
+			case resp := <-result:
+				assert.Len(t, resp.Array, 1)
+				assert.Equal(t, []string{added.String}, entryIDs(resp.Array[0].Array[1]))
+			case <-time.After(time.Second):
+				t.Fatal("XREAD BLOCK was not woken up by XADD")
+			}
+		})
+	}
+}
+
+func TestXAddCommand_MaxLen(t *testing.T) {
+	ResetStore()
+	for i := 1; i <= 5; i++ {
+		resp := NewXddCommand(bulkArgs(CommandXADD, "events", "MAXLEN", "3", fmt.Sprintf("%d-0", i), "n", "v")).Execute(CommandContext{})
+		assert.Equal(t, fmt.Sprintf("%d-0", i), resp.String)
+	}
+
+	resp := NewXRangeCommand(bulkArgs(CommandXRANGE, "events", "-", "+")).Execute(CommandContext{})
+	assert.Equal(t, []string{"3-0", "4-0", "5-0"}, entryIDs(resp))
+
+	resp = NewXddCommand(bulkArgs(CommandXADD, "missing", "NOMKSTREAM", "*", "n", "v")).Execute(CommandContext{})
+	assert.True(t, resp.IsNil)
+	_, lookupStatus := store.Get("missing", AnyEntryType)
+	assert.Equal(t, NotFound, lookupStatus)
+}
+
+func TestXTrimCommand(t *testing.T) {
+	ResetStore()
+	for i := 1; i <= 250; i++ {
+		xAdd("events", fmt.Sprintf("%d-0", i), "n", "v")
+	}
+
+	// approximate trimming only removes whole chunks of entries
+	resp := NewXTrimCommand(bulkArgs(CommandXTRIM, "events", "MAXLEN", "~", "120")).Execute(CommandContext{})
+	assert.Equal(t, int64(100), resp.Integer)
+
+	resp = NewXTrimCommand(bulkArgs(CommandXTRIM, "events", "MINID", "=", "200")).Execute(CommandContext{})
+	assert.Equal(t, int64(99), resp.Integer)
+
+	resp = NewXTrimCommand(bulkArgs(CommandXTRIM, "events", "MAXLEN", "10", "LIMIT", "5")).Execute(CommandContext{})
+	assert.Equal(t, Error, resp.Type)
+
+	resp = NewXLenCommand(bulkArgs(CommandXLEN, "events")).Execute(CommandContext{})
+	assert.Equal(t, int64(51), resp.Integer)
+
+	resp = NewXRangeCommand(bulkArgs(CommandXRANGE, "events", "-", "+", "COUNT", "1")).Execute(CommandContext{})
+	assert.Equal(t, []string{"200-0"}, entryIDs(resp))
+}
+
+func TestXDelCommand(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "v")
+	xAdd("events", "2-0", "n", "v")
+
+	resp := NewXDelCommand(bulkArgs(CommandXDEL, "events", "2-0", "3-0")).Execute(CommandContext{})
+	assert.Equal(t, int64(1), resp.Integer)
+
+	resp = NewXLenCommand(bulkArgs(CommandXLEN, "events")).Execute(CommandContext{})
+	assert.Equal(t, int64(1), resp.Integer)
+
+	// the deleted top entry still counts as the last generated id
+	resp = xAdd("events", "2-0", "n", "v")
+	assert.Equal(t, Error, resp.Type)
+}
+
+func TestXTrimAndXDel_ReplicatedOnlyWhenTheyRemoveEntries(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "v")
+	xAdd("events", "2-0", "n", "v")
+
+	shouldReplicate := func(factory CommandFactory, args ...string) bool {
+		cmd := factory(bulkArgs(args...))
+		cmd.Execute(CommandContext{})
+		return cmd.(WriteCommand).ShouldReplicate()
+	}
+
+	assert.False(t, shouldReplicate(NewXTrimCommand, CommandXTRIM, "events", "MAXLEN", "5"))
+	assert.False(t, shouldReplicate(NewXTrimCommand, CommandXTRIM, "missing", "MAXLEN", "0"))
+	assert.False(t, shouldReplicate(NewXTrimCommand, CommandXTRIM, "events", "MAXLEN", "x"))
+	assert.True(t, shouldReplicate(NewXTrimCommand, CommandXTRIM, "events", "MAXLEN", "1"))
+
+	assert.False(t, shouldReplicate(NewXDelCommand, CommandXDEL, "events", "1-0"))
+	assert.False(t, shouldReplicate(NewXDelCommand, CommandXDEL, "events", "bad-id"))
+	assert.True(t, shouldReplicate(NewXDelCommand, CommandXDEL, "events", "2-0"))
+}
+
+func TestXAddCommand_PropagatesResolvedID(t *testing.T) {
+	ResetStore()
+	original := RESPValue{Type: Array, Array: bulkArgs(CommandXADD, "s", "MAXLEN", "10", "*", "f", "v")}
+	cmd := NewXddCommand(original.Array).(*XAddCommand)
+
+	result := cmd.Execute(CommandContext{})
+	assert.Equal(t, BulkString, result.Type)
+	assert.True(t, cmd.ShouldReplicate())
+
+	propagated := propagatedValues(cmd, original)
+	assert.Len(t, propagated, 1)
+	assert.Equal(t, bulkArgs(CommandXADD, "s", "MAXLEN", "10", result.String, "f", "v"), propagated[0].Array)
+	assert.Equal(t, "*", original.Array[4].String, "the client's command must not be modified")
+}
+
+func TestXAddCommand_RejectedIsNotReplicated(t *testing.T) {
+	ResetStore()
+	cmd := NewXddCommand(bulkArgs(CommandXADD, "s", "0-0", "f", "v")).(*XAddCommand)
+
+	result := cmd.Execute(CommandContext{})
+	assert.Equal(t, Error, result.Type)
+	assert.False(t, cmd.ShouldReplicate())
+}
+
+func TestSetCommand_PropagatesAbsoluteExpiry(t *testing.T) {
+	ResetStore()
+	original := RESPValue{Type: Array, Array: bulkArgs(CommandSET, "k", "v", "px", "5000")}
+	cmd := NewSetCommand(original.Array).(*SetCommand)
+
+	before := time.Now().UnixMilli()
+	cmd.Execute(CommandContext{})
+	propagated := propagatedValues(cmd, original)
+
+	assert.Len(t, propagated, 1)
+	assert.Equal(t, "PXAT", propagated[0].Array[3].String)
+	expireAt, err := strconv.ParseInt(propagated[0].Array[4].String, 10, 64)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, expireAt, before+5000)
+	assert.LessOrEqual(t, expireAt, time.Now().UnixMilli()+5000)
+
+	entry, status := store.Get("k", StringEntryType)
+	assert.Equal(t, Found, status)
+	assert.Equal(t, expireAt, *entry.ExpireAt)
+}
+
+func TestSetCommand_PXATInThePastDeletesKey(t *testing.T) {
+	ResetStore()
+	NewSetCommand(bulkArgs(CommandSET, "k", "v")).Execute(CommandContext{})
+	NewSetCommand(bulkArgs(CommandSET, "k", "v2", "PXAT", "1")).Execute(CommandContext{})
+
+	_, status := store.Get("k", StringEntryType)
+	assert.Equal(t, NotFound, status)
+}
+
+func TestWait_WakesOnAck(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+
+	master, replica := net.Pipe()
+	defer replica.Close()
+	defer unregisterReplica(master)
+	go func() {
+		_, pending := beginReplicaSync(master, 6380, "?", -1)
+		pending.complete(master)
+	}()
+	reader := NewTrackingBufReader(replica)
+	assert.NoError(t, readRDBPayload(reader.Reader, NewInMemoryStore()))
+	assert.Eventually(t, func() bool { _, online := countReplicasAckedAt(0); return online == 1 }, time.Second, time.Millisecond)
+
+	wait := func(client *ClientState) RESPValue {
+		return NewCommandWait(bulkArgs("WAIT", "1", "5000")).Execute(CommandContext{client: client})
+	}
+
+	// nothing written by this client, nothing to wait for
+	assert.Equal(t, int64(1), wait(&ClientState{}).Integer)
+
+	client := &ClientState{}
+	written := make(chan struct{})
+	go func() {
+		client.lastWriteOffset = broadcastToReplicas(RESPValue{Type: Array, Array: bulkArgs("SET", "k", "v")})
+		close(written)
+	}()
+	_, err := parseRESPValue(reader)
+	assert.NoError(t, err)
+	<-written
+	writeOffset := client.lastWriteOffset
+
+	result := make(chan RESPValue)
+	go func() { result <- wait(client) }()
+
+	getAck, err := parseRESPValue(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, bulkArgs("REPLCONF", "GETACK", "*"), getAck.Array)
+
+	UpdateReplicaAckOffsetByConn(master, writeOffset)
+	select {
+	case reply := <-result:
+		assert.Equal(t, int64(1), reply.Integer)
+	case <-time.After(time.Second):
+		t.Fatal("WAIT was not woken by the ACK")
+	}
+}
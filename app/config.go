@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/** a config parameter known to CONFIG GET/SET*/
+type configParam struct {
+	defaultValue string
+	// startup only parameters can only be given as a command line flag
+	startupOnly bool
+	// validate rejects values that must not be stored, nil accepts anything
+	validate func(value string) error
+	// apply takes a new value set at runtime into effect, nil if it is read on use
+	apply func(value string)
+}
+
+const (
+	ConfigSave             = "save"
+	ConfigAppendOnly       = "appendonly"
+	ConfigAppendFilename   = "appendfilename"
+	ConfigAppendFsync      = "appendfsync"
+	ConfigAofLoadTruncated = "aof-load-truncated"
+	ConfigAppendDirname    = "appenddirname"
+
+	ConfigReplDisklessSync = "repl-diskless-sync"
+	ConfigReplBacklogSize  = "repl-backlog-size"
+	ConfigReplicaReadOnly  = "replica-read-only"
+
+	ConfigReplPingReplicaPeriod = "repl-ping-replica-period"
+	ConfigReplTimeout           = "repl-timeout"
+
+	ConfigMinReplicasToWrite = "min-replicas-to-write"
+	ConfigMinReplicasMaxLag  = "min-replicas-max-lag"
+
+	ConfigAutoAofRewritePercentage = "auto-aof-rewrite-percentage"
+	ConfigAutoAofRewriteMinSize    = "auto-aof-rewrite-min-size"
+)
+
+var configParams = map[string]configParam{
+	ConfigSave: {
+		defaultValue: "",
+		validate: func(value string) error {
+			_, err := parseSavePoints(value)
+			return err
+		},
+	},
+	ConfigAppendOnly: {
+		defaultValue: "no",
+		startupOnly:  true,
+	},
+	ConfigAppendFilename: {
+		defaultValue: "appendonly.aof",
+		startupOnly:  true,
+	},
+	ConfigAppendFsync: {
+		defaultValue: AppendFsyncEverysec,
+		validate:     oneOf(AppendFsyncAlways, AppendFsyncEverysec, AppendFsyncNo),
+	},
+	ConfigAofLoadTruncated: {
+		defaultValue: "yes",
+		validate:     oneOf("yes", "no"),
+	},
+	ConfigReplDisklessSync: {
+		defaultValue: "no",
+		validate:     oneOf("yes", "no"),
+	},
+	ConfigReplicaReadOnly: {
+		defaultValue: "yes",
+		validate:     oneOf("yes", "no"),
+	},
+	ConfigReplPingReplicaPeriod: {
+		defaultValue: "10",
+		validate:     positiveInt,
+	},
+	ConfigReplTimeout: {
+		defaultValue: "60",
+		validate:     positiveInt,
+	},
+	ConfigMinReplicasToWrite: {
+		defaultValue: "0",
+		validate:     nonNegativeInt,
+	},
+	ConfigMinReplicasMaxLag: {
+		defaultValue: "10",
+		validate:     nonNegativeInt,
+	},
+	ConfigReplBacklogSize: {
+		defaultValue: "1048576",
+		validate: func(value string) error {
+			if size, err := parseMemorySize(value); err != nil || size < minReplBacklogSize {
+				return fmt.Errorf("argument must be a memory value of at least %d bytes", minReplBacklogSize)
+			}
+			return nil
+		},
+		apply: func(value string) {
+			size, _ := parseMemorySize(value)
+			resizeReplicationBacklog(size)
+		},
+	},
+	ConfigAppendDirname: {
+		defaultValue: "appendonlydir",
+		startupOnly:  true,
+	},
+	ConfigAutoAofRewritePercentage: {
+		defaultValue: "100",
+		validate:     nonNegativeInt,
+	},
+	ConfigAutoAofRewriteMinSize: {
+		defaultValue: "67108864",
+		validate: func(value string) error {
+			_, err := parseMemorySize(value)
+			return err
+		},
+	},
+}
+
+const minReplBacklogSize = 16 * 1024
+
+var (
+	configMu        sync.RWMutex
+	configOverrides = make(map[string]string)
+)
+
+/** the current value of a config parameter: set with CONFIG SET, else the command line flag, else its default*/
+func getConfig(name string) (string, bool) {
+	name = strings.ToLower(name)
+
+	configMu.RLock()
+	val, ok := configOverrides[name]
+	configMu.RUnlock()
+	if ok {
+		return val, true
+	}
+
+	if val, ok := GetFlagValue(name); ok {
+		return val, true
+	}
+
+	if param, ok := configParams[name]; ok {
+		return param.defaultValue, true
+	}
+	return "", false
+}
+
+/** a yes/no config parameter*/
+func getBoolConfig(name string) bool {
+	val, _ := getConfig(name)
+	return strings.ToLower(val) == "yes"
+}
+
+/** an integer config parameter, 0 if it does not parse*/
+func getIntConfig(name string) int64 {
+	val, _ := getConfig(name)
+	n, _ := strconv.ParseInt(val, 10, 64)
+	return n
+}
+
+func setConfig(name, value string) error {
+	name = strings.ToLower(name)
+	param, ok := configParams[name]
+	if !ok {
+		return fmt.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", name)
+	}
+	if param.startupOnly {
+		return fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", name)
+	}
+
+	if param.validate != nil {
+		if err := param.validate(value); err != nil {
+			return fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - %v", name, err)
+		}
+	}
+
+	configMu.Lock()
+	configOverrides[name] = value
+	configMu.Unlock()
+
+	if param.apply != nil {
+		param.apply(value)
+	}
+	return nil
+}
+
+func oneOf(allowed ...string) func(string) error {
+	return func(value string) error {
+		for _, candidate := range allowed {
+			if strings.EqualFold(value, candidate) {
+				return nil
+			}
+		}
+		return fmt.Errorf("argument must be one of %s", strings.Join(allowed, ", "))
+	}
+}
+
+func nonNegativeInt(value string) error {
+	if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < 0 {
+		return fmt.Errorf("argument must be a non-negative integer")
+	}
+	return nil
+}
+
+func positiveInt(value string) error {
+	if n, err := strconv.ParseInt(value, 10, 64); err != nil || n <= 0 {
+		return fmt.Errorf("argument must be a positive integer")
+	}
+	return nil
+}
+
+/** parse a memory amount such as 1024, 64mb or 1gb into bytes*/
+func parseMemorySize(value string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	} {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	amount, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("argument must be a memory value")
+	}
+	return amount * multiplier, nil
+}
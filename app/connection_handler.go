@@ -3,17 +3,13 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"io"
 	"log"
 	"net"
-	"strconv"
 	"strings"
-	"sync/atomic"
+	"sync"
 	"time"
 )
 
-const maxWait = 30 * time.Second
-
 type ConnectionHandler interface {
 	HandleConnection() error
 	Close()
@@ -25,7 +21,11 @@ type MasterConnectionHandler struct {
 }
 
 func (handler MasterConnectionHandler) HandleConnection() error {
-	loadInitialDatabase()
+	if err := loadInitialDatabase(); err != nil {
+		return err
+	}
+	startSaveScheduler()
+	startReplicationCron()
 	acceptConnections(handler.listener)
 
 	return nil
@@ -37,16 +37,18 @@ func (handler MasterConnectionHandler) Close() {
 
 type ReplicaConnectionHandler struct {
 	masterHost, masterPort, port string
-	readyToServe                 *atomic.Bool
 	listener                     net.Listener
 }
 
 func (handler ReplicaConnectionHandler) HandleConnection() error {
-	loadInitialDatabase()
-	err := handler.handleReplication()
-	if err != nil {
+	if err := loadInitialDatabase(); err != nil {
 		return err
 	}
+	startSaveScheduler()
+	startReplicationCron()
+
+	// the master may not be up yet, the link keeps retrying while clients are served
+	becomeReplicaOf(handler.masterHost, handler.masterPort)
 
 	acceptConnections(handler.listener)
 
@@ -67,11 +69,10 @@ func CreateConnectionHandler(listener net.Listener, port string) (ConnectionHand
 		}
 
 		return ReplicaConnectionHandler{
-			masterHost:   master[0],
-			masterPort:   master[1],
-			readyToServe: new(atomic.Bool),
-			port:         port,
-			listener:     listener,
+			masterHost: master[0],
+			masterPort: master[1],
+			port:       port,
+			listener:   listener,
 		}, nil
 	} else {
 		log.Println("a new master connection")
@@ -95,6 +96,7 @@ func conntectToMaster(host, port string) (net.Conn, error) {
 func handleConnection(conn net.Conn) (handOffConnection bool) {
 	handOffConnection = true
 	reader := NewTrackingBufReader(conn)
+	client := &ClientState{}
 	log.Println("New connection")
 
 	defer func() {
@@ -113,7 +115,29 @@ func handleConnection(conn net.Conn) (handOffConnection bool) {
 			return
 		}
 
+		writeCommand, isWrite := cmd.(WriteCommand)
+		if isWrite {
+			if rejection, rejected := rejectClientWrite(); rejected {
+				if err := writeSerializedDataToConnection(conn, RESPValue{Type: Error, String: rejection}); err != nil {
+					return
+				}
+				continue
+			}
+		}
+
+		commandContext := CommandContext{Conn: conn, client: client}
+		release := acquireWriteLock(isWrite, &commandContext)
+
 		afterCommadFunc := func(cmd RESPCommand, commandResult RESPValue) error {
+			if isWrite && writeCommand.ShouldReplicate() {
+				// persisted and propagated before the client sees the reply
+				for _, propagated := range propagatedValues(cmd, respVal) {
+					recordWrite(propagated)
+					client.lastWriteOffset = broadcastToReplicas(propagated)
+				}
+			}
+			release()
+
 			err := writeSerializedDataToConnection(conn, commandResult)
 			if err != nil {
 				return err
@@ -121,15 +145,13 @@ func handleConnection(conn net.Conn) (handOffConnection bool) {
 			if ka, ok := cmd.(KeepAliveCommand); ok && ka.KeepsConnectionAlive() {
 				log.Println("Command takes over connection lifecycle")
 				handOffConnection = false
-				go initiateCommandExecutionLoop(conn, reader, nil)
+				go func() {
+					// the connection serves a replica now, its end is the end of that replica
+					initiateCommandExecutionLoop(conn, reader, nil)
+					unregisterReplica(conn)
+				}()
 			}
 
-			if replicableCommand, ok := cmd.(WriteCommand); ok {
-				if replicableCommand.ShouldReplicate() {
-					log.Println("Replicating command to all replicas")
-					broadcastToReplicas(respVal)
-				}
-			}
 			if postAction, ok := cmd.(PostCommandExecuteAction); ok {
 				if err := postAction.HandlePostWrite(conn); err != nil {
 					log.Printf("Post-Execution action failed: %v", err)
@@ -139,7 +161,56 @@ func handleConnection(conn net.Conn) (handOffConnection bool) {
 			return nil
 		}
 
-		executeRespCommand(cmd, CommandContext{Conn: conn}, &ExcecuteCommandHook{AfterCommndFunc: afterCommadFunc})
+		executeRespCommand(cmd, commandContext, &ExcecuteCommandHook{AfterCommndFunc: afterCommadFunc})
+		release()
+		if !handOffConnection {
+			// another routine reads from the connection now, it must be the only reader
+			return
+		}
+	}
+}
+
+/**
+ * held from the start of a write command until it is persisted and propagated, so the AOF and every
+ * replica see writes in the order they were applied. a command that blocks releases it while it waits
+ */
+var writeCommandMu sync.Mutex
+
+/** take the write lock for a write command and hand it to its context. the returned release is idempotent*/
+func acquireWriteLock(isWrite bool, commandContext *CommandContext) (release func()) {
+	if !isWrite {
+		return func() {}
+	}
+	writeCommandMu.Lock()
+	commandContext.writeLock = &writeCommandMu
+	var once sync.Once
+	return func() { once.Do(writeCommandMu.Unlock) }
+}
+
+/**
+ * why a write from a client must not run: a read only replica takes writes from its master link only,
+ * and a master with min-replicas-to-write set needs that many replicas that acked within min-replicas-max-lag
+ */
+func rejectClientWrite() (string, bool) {
+	if getRole() == "slave" {
+		return ErrReadOnlyReplica, getBoolConfig(ConfigReplicaReadOnly)
+	}
+
+	minReplicas := getIntConfig(ConfigMinReplicasToWrite)
+	if minReplicas == 0 {
+		return "", false
+	}
+	maxLag := time.Duration(getIntConfig(ConfigMinReplicasMaxLag)) * time.Second
+	return ErrNoReplicas, int64(countGoodReplicas(maxLag)) < minReplicas
+}
+
+/** bookkeeping for a write that changed the dataset, whether it came from a client or from the master*/
+func recordWrite(command RESPValue) {
+	rdbPersistence.AddChanges(1)
+	if aof != nil {
+		if err := aof.Append(command); err != nil {
+			log.Printf("failed appending to the AOF: %v", err)
+		}
 	}
 }
 
@@ -176,49 +247,24 @@ func parseRESPCommand(reader *TrackingBufReader) (RESPCommand, RESPValue, error)
 	return cmd, val, nil
 }
 
-func (handler *ReplicaConnectionHandler) handleReplication() error {
-	conn, err := conntectToMaster(handler.masterHost, handler.masterPort)
-	if err != nil {
-		log.Printf("Unable to connect with master:, error: %q", err)
-		return err
-	}
-
-	trackBufReader := NewTrackingBufReader(conn)
-
-	if err := handler.performReplicationHandshake(conn, handler.port, trackBufReader.Reader); err != nil {
-		log.Printf("Replication handshake with master failed: %v", err)
-		return err
-	}
-	stats := &ReplicaTrackingBytes{}
-	go handler.startReplicationRead(conn, trackBufReader, stats, maxWait)
-	return nil
-}
-
-func (handler *ReplicaConnectionHandler) startReplicationRead(conn net.Conn, reader *TrackingBufReader, replicaStats *ReplicaTrackingBytes, timeout time.Duration) {
-	deadline := time.Now().Add(timeout)
-	for !handler.readyToServe.Load() {
-		log.Println("[REPLICA] Not ready yet, blocking client")
-		time.Sleep(10 * time.Millisecond)
-		if time.Now().After(deadline) {
-			log.Println("[REPLICA] timed out waiting to become ready")
-			return
-		}
-	}
-
-	log.Println("[REPLICA] accepting connections")
-	initiateCommandExecutionLoop(conn, reader, replicaStats)
-}
-
 func initiateCommandExecutionLoop(conn net.Conn, reader *TrackingBufReader, replicaStats *ReplicaTrackingBytes) {
 	defer conn.Close()
 	for {
-		cmd, _, err := parseRESPCommand(reader)
+		cmd, respVal, err := parseRESPCommand(reader)
 		if err != nil {
 			fmt.Fprintf(conn, "-ERR %v\r\n", err)
 			return
 		}
 
+		writeCommand, isWrite := cmd.(WriteCommand)
+		commandContext := CommandContext{Conn: conn, replicaStats: replicaStats}
+		release := acquireWriteLock(isWrite, &commandContext)
+
 		afterCommandFunc := func(cmd RESPCommand, commandResult RESPValue) error {
+			defer release()
+			if isWrite && writeCommand.ShouldReplicate() {
+				recordWrite(respVal)
+			}
 			if sendResponseToMasterCommand, ok := cmd.(SendResonseToMaster); ok && sendResponseToMasterCommand.ShouldResponseBackToMaster() {
 				log.Printf("[REPLICA] writing response to master")
 				writeErr := writeSerializedDataToConnection(conn, commandResult)
@@ -228,74 +274,70 @@ func initiateCommandExecutionLoop(conn net.Conn, reader *TrackingBufReader, repl
 			}
 			if replicaStats != nil {
 				reader.FlushTo(replicaStats)
+				// the stream from our master is our own replication stream: it feeds the backlog and our replicas
+				broadcastToReplicas(respVal)
 			}
 			return nil
 		}
 
-		executeRespCommand(cmd, CommandContext{Conn: conn, replicaStats: replicaStats}, &ExcecuteCommandHook{AfterCommndFunc: afterCommandFunc})
+		executeRespCommand(cmd, commandContext, &ExcecuteCommandHook{AfterCommndFunc: afterCommandFunc})
+		release()
 	}
 }
 
-func (handler *ReplicaConnectionHandler) performReplicationHandshake(conn net.Conn, localPort string, reader *bufio.Reader) error {
+/** handshake with the master, returning the stats that track the replication offset of the stream that follows*/
+func performReplicationHandshake(conn net.Conn, localPort string, reader *bufio.Reader) (*ReplicaTrackingBytes, error) {
 	log.Println("Replica: sending ping")
 	if err := sendPing(conn); err != nil {
-		return fmt.Errorf("PING failed: %w", err)
+		return nil, fmt.Errorf("PING failed: %w", err)
 	}
 
 	log.Println("Replica: sending listening-port")
 	if err := sendReplConf(conn, "listening-port", localPort); err != nil {
-		return fmt.Errorf("REPLCONF listening-port failed: %w", err)
+		return nil, fmt.Errorf("REPLCONF listening-port failed: %w", err)
 	}
 
 	log.Println("Replica: sending cap pysnc2")
 	if err := sendReplConf(conn, "capa", "psync2"); err != nil {
-		return fmt.Errorf("REPLCONF capa failed: %w", err)
+		return nil, fmt.Errorf("REPLCONF capa failed: %w", err)
 	}
 
 	log.Println("Replica: sending Psync")
-	if err := sendPsync(conn); err != nil {
-		return fmt.Errorf("PSYNC failed: %w", err)
-	}
-	log.Println("Replica: reading bulk header")
-
-	bulkHeader, err := reader.ReadString('\n')
+	replID, offset := psyncArgs()
+	reply, err := sendPsync(conn, replID, offset)
 	if err != nil {
-		return fmt.Errorf("failed to read bulk string header: %w", err)
-	}
-	log.Printf("Bulk Header: %s", bulkHeader)
-
-	if !strings.HasPrefix(bulkHeader, "$") {
-		return fmt.Errorf("expected RESP bulk string, got: %s", bulkHeader)
+		return nil, fmt.Errorf("PSYNC failed: %w", err)
 	}
-
-	sizeStr := strings.TrimPrefix(bulkHeader, "$")
-	sizeStr = strings.TrimSpace(sizeStr)
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil {
-		return fmt.Errorf("invalid bulk size: %w", err)
+	if reply.fullResync {
+		log.Println("Replica: reading RDB payload")
+		store.Flush()
+		if err := readRDBPayload(reader, store); err != nil {
+			return nil, err
+		}
+		log.Println("Replica: RDB sync complete")
+	} else {
+		log.Println("Replica: partial resync, continuing the replication stream")
 	}
 
-	log.Printf("Reading %d bytes of RDB data from master", size)
-	limitedReader := io.LimitReader(reader, int64(size))
+	return applyPsyncReply(reply), nil
+}
 
-	err = parseRDB(limitedReader, store)
-	if err != nil {
-		return fmt.Errorf("failed to parse RDB data: %w", err)
+/** load the dataset from the AOF when appendonly is on, otherwise from the RDB file. only AOF failures are fatal*/
+func loadInitialDatabase() error {
+	if getBoolConfig(ConfigAppendOnly) {
+		if err := initAppendOnlyFile(); err != nil {
+			return fmt.Errorf("failed loading the append only file: %w", err)
+		}
+		return nil
 	}
 
-	log.Println("Replica: RDB sync complete")
-	handler.readyToServe.Store(true)
-
-	return nil
-}
-
-func loadInitialDatabase() {
 	dir, _ := GetFlagValue(FlagDir)
 	dbFileName, _ := GetFlagValue(FlagDbFilename)
 
 	if err := LoadRDBFile(dir, dbFileName, store); err != nil {
 		log.Printf("Error loading RDB file: %v", err)
 	}
+	return nil
 }
 
 func acceptConnections(listener net.Listener) {
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleConnection_ReadOnlyReplica(t *testing.T) {
+	ResetStore()
+	masterLinkMu.Lock()
+	masterLink = &replicationLink{}
+	masterLinkMu.Unlock()
+	defer func() {
+		masterLinkMu.Lock()
+		masterLink = nil
+		masterLinkMu.Unlock()
+		delete(configOverrides, ConfigReplicaReadOnly)
+	}()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go handleConnection(server)
+	reader := NewTrackingBufReader(client)
+	send := func(args ...string) RESPValue {
+		data, _ := RESPValue{Type: Array, Array: bulkArgs(args...)}.Serialize()
+		client.Write(data)
+		reply, err := parseRESPValue(reader)
+		assert.NoError(t, err)
+		return reply
+	}
+
+	reply := send("SET", "k", "v")
+	assert.Equal(t, Error, reply.Type)
+	assert.Equal(t, ErrReadOnlyReplica, reply.String)
+	assert.Equal(t, BulkString, send("GET", "k").Type)
+	_, status := store.Get("k", StringEntryType)
+	assert.Equal(t, NotFound, status)
+
+	assert.Equal(t, "OK", send("CONFIG", "SET", ConfigReplicaReadOnly, "no").String)
+	assert.Equal(t, "OK", send("SET", "k", "v").String)
+}
+
+func TestRejectClientWrite_MinReplicas(t *testing.T) {
+	defer delete(configOverrides, ConfigMinReplicasToWrite)
+
+	rejection, rejected := rejectClientWrite()
+	assert.False(t, rejected)
+
+	assert.NoError(t, setConfig(ConfigMinReplicasToWrite, "1"))
+	rejection, rejected = rejectClientWrite()
+	assert.True(t, rejected)
+	assert.Equal(t, ErrNoReplicas, rejection)
+
+	conn, _ := net.Pipe()
+	defer unregisterReplica(conn)
+	replica := registerReplica(conn, 6380, 0)
+	replica.online = true
+	UpdateReplicaAckOffsetByConn(conn, 0)
+	_, rejected = rejectClientWrite()
+	assert.False(t, rejected)
+
+	// the last ACK is older than min-replicas-max-lag
+	replica.Mu.Lock()
+	replica.LastAckTime = time.Now().Add(-11 * time.Second)
+	replica.Mu.Unlock()
+	_, rejected = rejectClientWrite()
+	assert.True(t, rejected)
+}
+
+func TestHandleConnection_PsyncHandsOffTheReader(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+
+	server, client := net.Pipe()
+	defer client.Close()
+	go handleConnection(server)
+	reader := NewTrackingBufReader(client)
+	send := func(args ...string) {
+		data, _ := RESPValue{Type: Array, Array: bulkArgs(args...)}.Serialize()
+		_, err := client.Write(data)
+		assert.NoError(t, err)
+	}
+
+	send("REPLCONF", "listening-port", "6380")
+	ok, err := reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.Equal(t, "+OK\r\n", ok)
+	send("PSYNC", "?", "-1")
+	_, err = reader.ReadString('\n')
+	assert.NoError(t, err)
+	assert.NoError(t, readRDBPayload(reader.Reader, NewInMemoryStore()))
+	// whatever the master propagates from now on is not of interest
+	go io.Copy(io.Discard, reader)
+
+	// heartbeats must all reach the replica loop, none may be swallowed by the client loop
+	for offset := 1; offset <= 20; offset++ {
+		send("REPLCONF", "ACK", strconv.Itoa(offset))
+	}
+	assert.Eventually(t, func() bool {
+		acked, _ := countReplicasAckedAt(20)
+		return acked == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestHandleConnection_BlockedWriteReleasesTheWriteLock(t *testing.T) {
+	ResetStore()
+	xAdd("s", "1-1", "f", "v")
+	execute(NewXGroupCommand, "XGROUP", "CREATE", "s", "g", "$")
+
+	dial := func() (send func(args ...string), reply func() RESPValue) {
+		server, client := net.Pipe()
+		t.Cleanup(func() { client.Close() })
+		go handleConnection(server)
+		reader := NewTrackingBufReader(client)
+		send = func(args ...string) {
+			data, _ := RESPValue{Type: Array, Array: bulkArgs(args...)}.Serialize()
+			client.Write(data)
+		}
+		reply = func() RESPValue {
+			val, err := parseRESPValue(reader)
+			assert.NoError(t, err)
+			return val
+		}
+		return send, reply
+	}
+
+	readSend, readReply := dial()
+	readSend("XREADGROUP", "GROUP", "g", "c", "BLOCK", "0", "STREAMS", "s", ">")
+	time.Sleep(50 * time.Millisecond)
+
+	// the blocked XREADGROUP holds no lock, so the XADD that wakes it can run
+	addSend, addReply := dial()
+	addSend("XADD", "s", "2-1", "f", "v")
+	assert.Equal(t, "2-1", addReply().String)
+
+	delivered := readReply()
+	assert.Equal(t, Array, delivered.Type)
+	assert.Len(t, delivered.Array, 1)
+}
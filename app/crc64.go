@@ -0,0 +1,58 @@
+package main
+
+import (
+	"hash/crc64"
+	"io"
+)
+
+/**
+ * redis checksums rdb files with the Jones CRC64 (reflected, no initial or final xor).
+ * hash/crc64 inverts the crc before and after every update, so those inversions are undone here
+ */
+const crc64JonesPoly = 0x95AC9329AC4BC9B5
+
+var crc64JonesTable = crc64.MakeTable(crc64JonesPoly)
+
+func crc64Jones(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, crc64JonesTable, p)
+}
+
+/** reader that keeps a running CRC64 of every byte read through it*/
+type crc64Reader struct {
+	reader io.Reader
+	crc    uint64
+}
+
+func newCRC64Reader(reader io.Reader) *crc64Reader {
+	return &crc64Reader{reader: reader}
+}
+
+func (r *crc64Reader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.crc = crc64Jones(r.crc, p[:n])
+	return n, err
+}
+
+func (r *crc64Reader) Sum() uint64 {
+	return r.crc
+}
+
+/** writer that keeps a running CRC64 of every byte written through it*/
+type crc64Writer struct {
+	writer io.Writer
+	crc    uint64
+}
+
+func newCRC64Writer(writer io.Writer) *crc64Writer {
+	return &crc64Writer{writer: writer}
+}
+
+func (w *crc64Writer) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.crc = crc64Jones(w.crc, p[:n])
+	return n, err
+}
+
+func (w *crc64Writer) Sum() uint64 {
+	return w.crc
+}
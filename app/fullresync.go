@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// length of the random delimiter that ends a diskless RDB transfer
+const rdbEOFMarkLength = 40
+
+/** what the master agreed to in its PSYNC reply, carried out once the reply was written*/
+type replicaSync struct {
+	state *ReplicaState
+	// the dataset to transfer, nil for a partial resync
+	snapshot map[string]Entry
+}
+
+/**
+ * answer PSYNC <replid> <offset>. the replica continues from the backlog when it asks for our replid and the
+ * offset is still covered, anything else is a full resync. the replica is registered under replicationMu,
+ * so every write propagated after its snapshot or backlog tail ends up in its buffer. writes hold
+ * writeCommandMu from being applied until they are propagated, so taking it first keeps a write that is
+ * applied but not propagated yet out of the snapshot, it would reach the replica twice otherwise
+ */
+func beginReplicaSync(conn net.Conn, listeningPort int, replID string, psyncOffset int64) (RESPValue, replicaSync) {
+	writeCommandMu.Lock()
+	defer writeCommandMu.Unlock()
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+
+	backlog := ensureReplicationBacklog()
+	if canContinueHistory(replID, psyncOffset) {
+		if missing, ok := backlog.readFrom(psyncOffset); ok {
+			state := registerReplica(conn, listeningPort, backlog.offset)
+			state.buffer = missing
+			log.Printf("partial resync of %s from offset %d, %d bytes missing", state.Addr, psyncOffset, len(missing))
+			return RESPValue{Type: SimpleString, String: "CONTINUE " + GetMasterReplId()}, replicaSync{state: state}
+		}
+	}
+
+	state := registerReplica(conn, listeningPort, backlog.offset)
+	pending := replicaSync{state: state, snapshot: store.Snapshot()}
+	return RESPValue{Type: SimpleString, String: fmt.Sprintf("FULLRESYNC %s %d", GetMasterReplId(), backlog.offset)}, pending
+}
+
+/**
+ * after +FULLRESYNC the snapshot is sent as RDB, after +CONTINUE nothing is. either way the buffered writes
+ * (for a partial resync, starting with the missing backlog bytes) are flushed and the replica goes online
+ */
+func (pending replicaSync) complete(conn net.Conn) error {
+	var err error
+	if pending.snapshot != nil {
+		if getBoolConfig(ConfigReplDisklessSync) {
+			err = sendDisklessRDB(conn, pending.snapshot)
+		} else {
+			err = sendDiskRDB(conn, pending.snapshot)
+		}
+	}
+	if err == nil {
+		err = pending.state.goOnline()
+	}
+	if err != nil {
+		unregisterReplica(conn)
+		return err
+	}
+
+	log.Printf("replica %s is online", pending.state.Addr)
+	return nil
+}
+
+/** write the snapshot to a temp file and send it as a regular bulk string `$<length>\r\n<rdb>` (no trailing CRLF)*/
+func sendDiskRDB(conn net.Conn, snapshot map[string]Entry) error {
+	tmp, err := os.CreateTemp("", "temp-repl-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := bufio.NewWriter(tmp)
+	if err := encodeRDB(writer, snapshot); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(conn, "$%d\r\n", size); err != nil {
+		return err
+	}
+	_, err = io.Copy(conn, tmp)
+	return err
+}
+
+/** stream the snapshot straight to the socket as `$EOF:<mark>\r\n<rdb><mark>`, the length is not known upfront*/
+func sendDisklessRDB(conn net.Conn, snapshot map[string]Entry) error {
+	mark, err := randomHex(rdbEOFMarkLength)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(conn)
+	fmt.Fprintf(writer, "$EOF:%s\r\n", mark)
+	if err := encodeRDB(writer, snapshot); err != nil {
+		return err
+	}
+	writer.WriteString(mark)
+	return writer.Flush()
+}
+
+/** a random string of n hex characters*/
+func randomHex(n int) (string, error) {
+	buf := make([]byte, (n+1)/2)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf)[:n], nil
+}
+
+/**
+ * read the RDB payload the master sends after +FULLRESYNC into the store, in either format:
+ * `$<length>\r\n` followed by exactly length bytes, or diskless `$EOF:<mark>\r\n` with the mark after the RDB
+ */
+func readRDBPayload(reader *bufio.Reader, target Store) error {
+	bulkHeader, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read bulk string header: %w", err)
+	}
+	log.Printf("Bulk Header: %s", bulkHeader)
+
+	if !strings.HasPrefix(bulkHeader, "$") {
+		return fmt.Errorf("expected RESP bulk string, got: %s", bulkHeader)
+	}
+	header := strings.TrimSpace(strings.TrimPrefix(bulkHeader, "$"))
+
+	if mark, isDiskless := strings.CutPrefix(header, "EOF:"); isDiskless {
+		if len(mark) != rdbEOFMarkLength {
+			return fmt.Errorf("invalid diskless EOF mark: %q", mark)
+		}
+		// the parser stops right after the checksum, which is where the mark starts
+		if err := parseRDB(reader, target); err != nil {
+			return fmt.Errorf("failed to parse RDB data: %w", err)
+		}
+		trailer, err := readNBytes(reader, rdbEOFMarkLength)
+		if err != nil {
+			return fmt.Errorf("failed to read diskless EOF mark: %w", err)
+		}
+		if string(trailer) != mark {
+			return fmt.Errorf("diskless EOF mark mismatch")
+		}
+		return nil
+	}
+
+	size, err := strconv.Atoi(header)
+	if err != nil {
+		return fmt.Errorf("invalid bulk size: %w", err)
+	}
+
+	log.Printf("Reading %d bytes of RDB data from master", size)
+	limitedReader := io.LimitReader(reader, int64(size))
+	if err := parseRDB(limitedReader, target); err != nil {
+		return fmt.Errorf("failed to parse RDB data: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFullResync(t *testing.T) {
+	defer delete(configOverrides, ConfigReplDisklessSync)
+
+	for _, diskless := range []string{"no", "yes"} {
+		t.Run("diskless "+diskless, func(t *testing.T) {
+			assert.NoError(t, setConfig(ConfigReplDisklessSync, diskless))
+			ResetStore()
+			store.Set("k", Entry{Val: "v", Type: StringEntryType})
+
+			masterConn, replicaConn := net.Pipe()
+			defer replicaConn.Close()
+			defer unregisterReplica(masterConn)
+
+			done := make(chan error, 1)
+			go func() {
+				reply, pending := beginReplicaSync(masterConn, 6380, "?", -1)
+				assert.True(t, strings.HasPrefix(reply.String, "FULLRESYNC "+GetMasterReplId()))
+				done <- pending.complete(masterConn)
+			}()
+
+			reader := NewTrackingBufReader(replicaConn)
+			// the transfer started, so the replica is registered and buffering
+			_, err := reader.Peek(1)
+			assert.NoError(t, err)
+			broadcastToReplicas(RESPValue{Type: Array, Array: bulkArgs("SET", "during", "sync")})
+
+			loaded := NewInMemoryStore()
+			assert.NoError(t, readRDBPayload(reader.Reader, loaded))
+			entry, status := loaded.Get("k", StringEntryType)
+			assert.Equal(t, Found, status)
+			assert.Equal(t, "v", entry.Val)
+
+			buffered, err := parseRESPValue(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, bulkArgs("SET", "during", "sync"), buffered.Array)
+			assert.NoError(t, <-done)
+
+			go broadcastToReplicas(RESPValue{Type: Array, Array: bulkArgs("SET", "after", "sync")})
+			direct, err := parseRESPValue(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, bulkArgs("SET", "after", "sync"), direct.Array)
+		})
+	}
+}
+
+func TestFullResync_WriteInFlight(t *testing.T) {
+	ResetStore()
+	masterConn, replicaConn := net.Pipe()
+	defer unregisterReplica(masterConn)
+	defer replicaConn.Close()
+
+	// a write that was applied but not propagated yet, the way handleConnection runs it
+	command := RESPValue{Type: Array, Array: bulkArgs("XADD", "s", "1-1", "f", "v")}
+	cmd, err := ParseRESPCommandFromArray(command.Array)
+	assert.NoError(t, err)
+	var commandContext CommandContext
+	release := acquireWriteLock(true, &commandContext)
+	cmd.Execute(commandContext)
+
+	done := make(chan error, 1)
+	go func() {
+		_, pending := beginReplicaSync(masterConn, 6380, "?", -1)
+		done <- pending.complete(masterConn)
+	}()
+	time.Sleep(50 * time.Millisecond)
+	broadcastToReplicas(command)
+	release()
+
+	reader := NewTrackingBufReader(replicaConn)
+	loaded := NewInMemoryStore()
+	assert.NoError(t, readRDBPayload(reader.Reader, loaded))
+	entry, status := loaded.Get("s", StreamEntryType)
+	assert.Equal(t, Found, status)
+	assert.Equal(t, 1, entry.Val.(*stream.Stream).Len())
+
+	// the write is in the snapshot only, the next thing the replica gets is the next write
+	go broadcastToReplicas(RESPValue{Type: Array, Array: bulkArgs("SET", "after", "sync")})
+	next, err := parseRESPValue(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, bulkArgs("SET", "after", "sync"), next.Array)
+	assert.NoError(t, <-done)
+}
+
+func TestPartialResync(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+
+	first, firstReplica := net.Pipe()
+	go func() {
+		_, pending := beginReplicaSync(first, 6380, "?", -1)
+		pending.complete(first)
+	}()
+	reader := NewTrackingBufReader(firstReplica)
+	assert.NoError(t, readRDBPayload(reader.Reader, NewInMemoryStore()))
+
+	set := func(key string) RESPValue { return RESPValue{Type: Array, Array: bulkArgs("SET", key, "v")} }
+	go broadcastToReplicas(set("seen"))
+	_, err := parseRESPValue(reader)
+	assert.NoError(t, err)
+	seenOffset := GetMasterReplOffset()
+
+	// the link drops and the replica misses a write
+	unregisterReplica(first)
+	firstReplica.Close()
+	broadcastToReplicas(set("missed"))
+
+	second, secondReplica := net.Pipe()
+	defer secondReplica.Close()
+	defer unregisterReplica(second)
+
+	reply, pending := beginReplicaSync(second, 6380, GetMasterReplId(), seenOffset+1)
+	assert.Equal(t, "CONTINUE "+GetMasterReplId(), reply.String)
+	assert.Nil(t, pending.snapshot)
+
+	go pending.complete(second)
+	missed, err := parseRESPValue(NewTrackingBufReader(secondReplica))
+	assert.NoError(t, err)
+	assert.Equal(t, bulkArgs("SET", "missed", "v"), missed.Array)
+
+	// an offset the backlog no longer covers, or another replid, needs a full resync
+	third, _ := net.Pipe()
+	defer unregisterReplica(third)
+	reply, _ = beginReplicaSync(third, 6380, GetMasterReplId(), GetMasterReplOffset()+2)
+	assert.Equal(t, fmt.Sprintf("FULLRESYNC %s %d", GetMasterReplId(), GetMasterReplOffset()), reply.String)
+}
+
+func resetReplication() {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	replBacklog = nil
+	masterReplOffset.Store(0)
+}
+
+func TestPartialResync_AfterReplicationIdShift(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+	oldID := GetMasterReplId()
+	defer setReplicationId(oldID)
+
+	replicationMu.Lock()
+	ensureReplicationBacklog().feed([]byte("*1\r\n$4\r\nPING\r\n"))
+	masterReplOffset.Store(replBacklog.offset)
+	replicationMu.Unlock()
+
+	shiftReplicationId(newReplId())
+	replid2, secondOffset := GetMasterReplId2()
+	assert.Equal(t, oldID, replid2)
+	assert.Equal(t, GetMasterReplOffset()+1, secondOffset)
+
+	// a former sibling still knows the old id
+	conn, _ := net.Pipe()
+	defer unregisterReplica(conn)
+	reply, _ := beginReplicaSync(conn, 6380, oldID, 1)
+	assert.Equal(t, "CONTINUE "+GetMasterReplId(), reply.String)
+	assert.False(t, canContinueHistory(oldID, secondOffset+1))
+}
@@ -13,9 +13,14 @@ type InfoSection struct {
 
 const (
 	InfoSectionReplication = "replication"
+	InfoSectionPersistence = "persistence"
 )
 
 var supportedInfoSections = []InfoSection{
+	{
+		Name:    InfoSectionPersistence,
+		GetInfo: persistenceInfo,
+	},
 	{
 		Name:    InfoSectionReplication,
 		GetInfo: replicationInfo,
@@ -41,24 +46,28 @@ func getSectionMap() map[string]InfoSection {
 	return sectionMap
 }
 
-/** return a map of all the supported info section. if no sections was provided then return the whole map*/
-func getSectionsByNames(names ...string) map[string]InfoSection {
-	allSections := getSectionMap()
+/** return the requested info sections in their INFO order. if no sections was provided then return all of them*/
+func getSectionsByNames(names ...string) []InfoSection {
 	if len(names) == 0 {
-		return allSections
+		return supportedInfoSections
 	}
 
-	filtered := make(map[string]InfoSection, len(names))
-
+	allSections := getSectionMap()
+	requested := make(map[string]bool, len(names))
 	for _, name := range names {
 		lowerCase := strings.ToLower(name)
-		section, isExist := allSections[lowerCase]
-		if isExist {
-			filtered[name] = section
+		if _, isExist := allSections[lowerCase]; isExist {
+			requested[lowerCase] = true
 		} else {
 			log.Println("unsupported info section", name)
 		}
+	}
 
+	var filtered []InfoSection
+	for _, section := range supportedInfoSections {
+		if requested[section.Name] {
+			filtered = append(filtered, section)
+		}
 	}
 
 	return filtered
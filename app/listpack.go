@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+const (
+	listpackHeaderSize = 6
+	listpackEnd        = 0xFF
+)
+
+/**
+ * decode a listpack blob (as stored in RDB for streams, hashes, sets, zsets and quicklists).
+ * integer elements are returned in their decimal string form.
+ */
+func decodeListpack(data []byte) ([]string, error) {
+	if len(data) < listpackHeaderSize+1 {
+		return nil, fmt.Errorf("listpack too short: %d bytes", len(data))
+	}
+
+	totalBytes := int(binary.LittleEndian.Uint32(data[0:4]))
+	if totalBytes != len(data) {
+		return nil, fmt.Errorf("listpack size mismatch: header %d, actual %d", totalBytes, len(data))
+	}
+
+	var elements []string
+	pos := listpackHeaderSize
+	for {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("listpack is missing its end marker")
+		}
+		if data[pos] == listpackEnd {
+			return elements, nil
+		}
+
+		value, entryLen, err := decodeListpackEntry(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+		pos += entryLen + listpackBacklenSize(entryLen)
+	}
+}
+
+/**
+ * decode a single listpack element.
+ * @return the element and the size of its encoding and data, without the trailing backlen
+ */
+func decodeListpackEntry(data []byte) (string, int, error) {
+	need := func(n int) error {
+		if len(data) < n {
+			return fmt.Errorf("listpack entry truncated")
+		}
+		return nil
+	}
+
+	b := data[0]
+	switch {
+	case b&0x80 == 0: // 7 bit unsigned int
+		return strconv.Itoa(int(b & 0x7F)), 1, nil
+
+	case b&0xC0 == 0x80: // 6 bit string length
+		length := int(b & 0x3F)
+		if err := need(1 + length); err != nil {
+			return "", 0, err
+		}
+		return string(data[1 : 1+length]), 1 + length, nil
+
+	case b&0xE0 == 0xC0: // 13 bit signed int
+		if err := need(2); err != nil {
+			return "", 0, err
+		}
+		uv := int64(b&0x1F)<<8 | int64(data[1])
+		if uv >= 1<<12 {
+			uv -= 1 << 13
+		}
+		return strconv.FormatInt(uv, 10), 2, nil
+
+	case b&0xF0 == 0xE0: // 12 bit string length
+		if err := need(2); err != nil {
+			return "", 0, err
+		}
+		length := int(b&0x0F)<<8 | int(data[1])
+		if err := need(2 + length); err != nil {
+			return "", 0, err
+		}
+		return string(data[2 : 2+length]), 2 + length, nil
+	}
+
+	switch b {
+	case 0xF0: // 32 bit string length
+		if err := need(5); err != nil {
+			return "", 0, err
+		}
+		length := int(binary.LittleEndian.Uint32(data[1:5]))
+		if err := need(5 + length); err != nil {
+			return "", 0, err
+		}
+		return string(data[5 : 5+length]), 5 + length, nil
+
+	case 0xF1: // 16 bit int
+		if err := need(3); err != nil {
+			return "", 0, err
+		}
+		return strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(data[1:3]))), 10), 3, nil
+
+	case 0xF2: // 24 bit int
+		if err := need(4); err != nil {
+			return "", 0, err
+		}
+		uv := int64(data[1]) | int64(data[2])<<8 | int64(data[3])<<16
+		if uv >= 1<<23 {
+			uv -= 1 << 24
+		}
+		return strconv.FormatInt(uv, 10), 4, nil
+
+	case 0xF3: // 32 bit int
+		if err := need(5); err != nil {
+			return "", 0, err
+		}
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(data[1:5]))), 10), 5, nil
+
+	case 0xF4: // 64 bit int
+		if err := need(9); err != nil {
+			return "", 0, err
+		}
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(data[1:9])), 10), 9, nil
+	}
+
+	return "", 0, fmt.Errorf("unknown listpack encoding: 0x%02X", b)
+}
+
+/** the number of bytes used to store the backlen of an entry of entryLen bytes*/
+func listpackBacklenSize(entryLen int) int {
+	switch {
+	case entryLen <= 127:
+		return 1
+	case entryLen < 16383:
+		return 2
+	case entryLen < 2097151:
+		return 3
+	case entryLen < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+/** encode elements as a listpack. elements that are canonical integers are stored as integers*/
+func encodeListpack(elements []string) []byte {
+	buf := make([]byte, listpackHeaderSize, 64)
+	for _, element := range elements {
+		entry := encodeListpackEntry(element)
+		buf = append(buf, entry...)
+		buf = append(buf, encodeListpackBacklen(len(entry))...)
+	}
+	buf = append(buf, listpackEnd)
+
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	numElements := len(elements)
+	if numElements > 65535 {
+		// too many elements to be counted in the header
+		numElements = 65535
+	}
+	binary.LittleEndian.PutUint16(buf[4:6], uint16(numElements))
+	return buf
+}
+
+func encodeListpackEntry(element string) []byte {
+	if v, err := strconv.ParseInt(element, 10, 64); err == nil && strconv.FormatInt(v, 10) == element {
+		return encodeListpackInt(v)
+	}
+
+	length := len(element)
+	var buf []byte
+	switch {
+	case length < 64:
+		buf = append(buf, 0x80|byte(length))
+	case length < 4096:
+		buf = append(buf, 0xE0|byte(length>>8), byte(length))
+	default:
+		buf = append(buf, 0xF0)
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(length))
+	}
+	return append(buf, element...)
+}
+
+func encodeListpackInt(v int64) []byte {
+	switch {
+	case v >= 0 && v <= 127:
+		return []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		uv := uint64(v)
+		if v < 0 {
+			uv = uint64((1 << 13) + v)
+		}
+		return []byte{0xC0 | byte(uv>>8)&0x1F, byte(uv)}
+	case v >= -32768 && v <= 32767:
+		return binary.LittleEndian.AppendUint16([]byte{0xF1}, uint16(v))
+	case v >= -8388608 && v <= 8388607:
+		uv := uint64(v)
+		return []byte{0xF2, byte(uv), byte(uv >> 8), byte(uv >> 16)}
+	case v >= -2147483648 && v <= 2147483647:
+		return binary.LittleEndian.AppendUint32([]byte{0xF3}, uint32(v))
+	default:
+		return binary.LittleEndian.AppendUint64([]byte{0xF4}, uint64(v))
+	}
+}
+
+func encodeListpackBacklen(entryLen int) []byte {
+	l := uint64(entryLen)
+	switch listpackBacklenSize(entryLen) {
+	case 1:
+		return []byte{byte(l)}
+	case 2:
+		return []byte{byte(l >> 7), byte(l&127) | 128}
+	case 3:
+		return []byte{byte(l >> 14), byte((l>>7)&127) | 128, byte(l&127) | 128}
+	case 4:
+		return []byte{byte(l >> 21), byte((l>>14)&127) | 128, byte((l>>7)&127) | 128, byte(l&127) | 128}
+	default:
+		return []byte{byte(l >> 28), byte((l>>21)&127) | 128, byte((l>>14)&127) | 128, byte((l>>7)&127) | 128, byte(l&127) | 128}
+	}
+}
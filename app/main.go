@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 )
 
 func main() {
+	parseFlags(os.Args)
 	log.Println("Logs from your program will appear here!")
 	port := resolvePort()
 
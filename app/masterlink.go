@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strconv"
+)
+
+/**
+ * the PSYNC arguments of a replica: its replication id and the next offset it wants, or "? -1" when it has
+ * no history to continue. a replica shares the id and the offsets of the master it follows
+ */
+func psyncArgs() (replID, offset string) {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+
+	if replBacklog == nil {
+		return "?", "-1"
+	}
+	return GetMasterReplId(), strconv.FormatInt(replBacklog.offset+1, 10)
+}
+
+/** take the master's PSYNC reply into account, returning the stats that track the offset of the stream that follows*/
+func applyPsyncReply(reply psyncReply) *ReplicaTrackingBytes {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+
+	switch {
+	case reply.fullResync:
+		// a new history: whatever our own replicas hold no longer matches
+		setReplicationId(reply.replID)
+		replBacklog = newReplicationBacklog(replBacklogSize(), reply.offset)
+		masterReplOffset.Store(reply.offset)
+		disconnectReplicas()
+	case reply.replID != "" && reply.replID != GetMasterReplId():
+		// the master was promoted and continues our history under a new id
+		shiftReplicationId(reply.replID)
+		disconnectReplicas()
+	}
+	return &ReplicaTrackingBytes{BytesRead: uint64(replBacklog.offset)}
+}
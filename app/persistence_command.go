@@ -0,0 +1,74 @@
+package main
+
+type SaveCommand struct {
+	values []RESPValue
+}
+
+func (s *SaveCommand) Name() string      { return CommandSAVE }
+func (s *SaveCommand) Args() []RESPValue { return s.values[1:] }
+func (s *SaveCommand) Execute(ctx CommandContext) RESPValue {
+	if len(s.Args()) != 0 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'save' command"}
+	}
+
+	if err := rdbPersistence.Save(); err != nil {
+		if err == ErrBgsaveInProgress {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		return RESPValue{Type: Error, String: "ERR " + err.Error()}
+	}
+	return RESPValue{Type: SimpleString, String: "OK"}
+}
+
+type BgSaveCommand struct {
+	values []RESPValue
+}
+
+func (b *BgSaveCommand) Name() string      { return CommandBGSAVE }
+func (b *BgSaveCommand) Args() []RESPValue { return b.values[1:] }
+func (b *BgSaveCommand) Execute(ctx CommandContext) RESPValue {
+	if len(b.Args()) != 0 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'bgsave' command"}
+	}
+
+	if err := rdbPersistence.BackgroundSave(); err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	return RESPValue{Type: SimpleString, String: "Background saving started"}
+}
+
+type LastSaveCommand struct {
+	values []RESPValue
+}
+
+func (l *LastSaveCommand) Name() string      { return CommandLASTSAVE }
+func (l *LastSaveCommand) Args() []RESPValue { return l.values[1:] }
+func (l *LastSaveCommand) Execute(ctx CommandContext) RESPValue {
+	if len(l.Args()) != 0 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'lastsave' command"}
+	}
+	return RESPValue{Type: Integer, Integer: rdbPersistence.LastSaveTime().Unix()}
+}
+
+type BgRewriteAofCommand struct {
+	values []RESPValue
+}
+
+func (b *BgRewriteAofCommand) Name() string      { return CommandBGREWRITEAOF }
+func (b *BgRewriteAofCommand) Args() []RESPValue { return b.values[1:] }
+func (b *BgRewriteAofCommand) Execute(ctx CommandContext) RESPValue {
+	if len(b.Args()) != 0 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'bgrewriteaof' command"}
+	}
+	if aof == nil {
+		return RESPValue{Type: Error, String: "ERR Background append only file rewriting needs appendonly yes"}
+	}
+
+	if err := aof.StartRewrite(); err != nil {
+		if err == ErrAofRewriteInProgress {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		return RESPValue{Type: Error, String: "ERR " + err.Error()}
+	}
+	return RESPValue{Type: SimpleString, String: "Background append only file rewriting started"}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"text/template"
+)
+
+const persistenceTemplate = `# Persistence
+loading:0
+rdb_changes_since_last_save:{{.ChangesSinceLastSave}}
+rdb_bgsave_in_progress:{{.BgsaveInProgress}}
+rdb_last_save_time:{{.LastSaveTime}}
+rdb_last_bgsave_status:{{.LastBgsaveStatus}}
+aof_enabled:{{.AofEnabled}}
+aof_rewrite_in_progress:{{.AofRewriteInProgress}}
+aof_last_bgrewrite_status:{{.AofLastBgrewriteStatus}}{{if .AofEnabled}}
+aof_current_size:{{.AofCurrentSize}}
+aof_base_size:{{.AofBaseSize}}{{end}}`
+
+type PersistenceData struct {
+	ChangesSinceLastSave int64
+	BgsaveInProgress     int
+	LastSaveTime         int64
+	LastBgsaveStatus     string
+
+	AofEnabled             int
+	AofRewriteInProgress   int
+	AofLastBgrewriteStatus string
+	AofCurrentSize         int64
+	AofBaseSize            int64
+}
+
+func persistenceInfo() string {
+	data := PersistenceData{
+		ChangesSinceLastSave: rdbPersistence.ChangesSinceLastSave(),
+		LastSaveTime:         rdbPersistence.LastSaveTime().Unix(),
+		LastBgsaveStatus:     "ok",
+
+		AofLastBgrewriteStatus: "ok",
+	}
+	if rdbPersistence.BgsaveInProgress() {
+		data.BgsaveInProgress = 1
+	}
+	if !rdbPersistence.LastBgsaveOK() {
+		data.LastBgsaveStatus = "err"
+	}
+	if aof != nil {
+		data.AofEnabled = 1
+		if aof.RewriteInProgress() {
+			data.AofRewriteInProgress = 1
+		}
+		if !aof.LastRewriteOK() {
+			data.AofLastBgrewriteStatus = "err"
+		}
+		data.AofCurrentSize, data.AofBaseSize = aof.Sizes()
+	}
+
+	tmpl, err := template.New(InfoSectionPersistence).Parse(persistenceTemplate)
+	if err != nil {
+		panic(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		panic(err)
+	}
+
+	return buf.String()
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/taroim/rdb/lzf"
 )
@@ -21,8 +22,33 @@ const (
 	DB_SELECTOR      = 0x00
 	RDB_EOF          = 0xFF
 	AUXILIARY_FIELD  = 0xFA
+	RESIZE_DB        = 0xFB
+	EXPIRETIME_MS    = 0xFC
+	EXPIRETIME       = 0xFD
 
 	TWO_MOST_SIGINFICANT_BITS = 0xC0
+	RDB_32BIT_LEN             = 0x80
+	RDB_64BIT_LEN             = 0x81
+
+	RDB_TYPE_STRING             = 0x00
+	RDB_TYPE_LIST               = 1
+	RDB_TYPE_SET                = 2
+	RDB_TYPE_ZSET               = 3
+	RDB_TYPE_HASH               = 4
+	RDB_TYPE_ZSET_2             = 5
+	RDB_TYPE_HASH_ZIPMAP        = 9
+	RDB_TYPE_LIST_ZIPLIST       = 10
+	RDB_TYPE_SET_INTSET         = 11
+	RDB_TYPE_ZSET_ZIPLIST       = 12
+	RDB_TYPE_HASH_ZIPLIST       = 13
+	RDB_TYPE_LIST_QUICKLIST     = 14
+	RDB_TYPE_HASH_LISTPACK      = 16
+	RDB_TYPE_ZSET_LISTPACK      = 17
+	RDB_TYPE_LIST_QUICKLIST_2   = 18
+	RDB_TYPE_SET_LISTPACK       = 20
+	RDB_TYPE_STREAM_LISTPACKS   = 15
+	RDB_TYPE_STREAM_LISTPACKS_2 = 19
+	RDB_TYPE_STREAM_LISTPACKS_3 = 21
 )
 
 func LoadRDBFile(dir, dbFilename string, store Store) error {
@@ -58,12 +84,19 @@ func GetFile(dir, dbFilename string) (*os.File, error) {
 
 func parseRDB(reader io.Reader, store Store) error {
 	visitor := &RDBStoreVisitor{store: store}
+	checksumReader := newCRC64Reader(reader)
 	_, err := parseHeader(visitor).
 		Next(parseMetadata(visitor)).
-		Next(parseDb(visitor))(reader)
+		Next(parseDb(visitor, checksumReader))(checksumReader)
 	return err
 }
 
+/** files written with checksums disabled carry a zero checksum, by default those are loaded without verification*/
+func skipZeroChecksum() bool {
+	val, exists := GetFlagValue(FlagRdbSkipZeroChecksum)
+	return !exists || strings.ToLower(val) != "no"
+}
+
 func readRdbString(reader io.Reader) (string, error) {
 	enc, err := readLengthEncoded(reader)
 	if err != nil {
@@ -83,6 +116,7 @@ const (
 	LengthEncoding6Bit LengthEncodingModeEnum = iota
 	LengthEncoding14Bit
 	LengthEncoding32Bit
+	LengthEncoding64Bit
 	LengthEncodingSpecial
 )
 
@@ -146,7 +180,20 @@ func readLengthEncoded(reader io.Reader) (*LengthEncoding, error) {
 			Value:     length,
 		}, nil
 
-	case 2: // 32-bit
+	case 2: // 32-bit or 64-bit
+		if b == RDB_64BIT_LEN {
+			lenBytes, err := readNBytes(reader, 8)
+			if err != nil {
+				return nil, err
+			}
+			length := int(binary.BigEndian.Uint64(lenBytes))
+			return &LengthEncoding{
+				Mode:      LengthEncoding64Bit,
+				BitLength: 64,
+				Value:     length,
+			}, nil
+		}
+
 		lenBytes, err := readNBytes(reader, 4)
 		if err != nil {
 			return nil, err
@@ -201,18 +248,18 @@ func readSpecialFormat(reader io.Reader, encodeType StringEncodingEnum) (string,
 		}
 		return strconv.Itoa(int(int8(num[0]))), nil
 	case StringEncodingInt16:
-		num, err := readNBytes(reader, 1)
+		num, err := readNBytes(reader, 2)
 		if err != nil {
 			return "", err
 		}
-		val := int16(binary.BigEndian.Uint16(num))
+		val := int16(binary.LittleEndian.Uint16(num))
 		return strconv.Itoa(int(val)), nil
 	case StringEncodingInt32:
 		num, err := readNBytes(reader, 4)
 		if err != nil {
 			return "", err
 		}
-		val := int32(binary.BigEndian.Uint32(num))
+		val := int32(binary.LittleEndian.Uint32(num))
 		return strconv.Itoa(int(val)), nil
 	case StringEncodingLZF:
 		return readCompressedString(reader)
@@ -340,7 +387,10 @@ func parseMetadata(visitor RDBVisitor) ParserFunc {
 	}
 }
 
-func parseDb(visitor RDBVisitor) ParserFunc {
+/**
+ * @param checksum the reader wrapping the whole file, its running crc is compared with the trailing checksum at EOF
+ */
+func parseDb(visitor RDBVisitor, checksum *crc64Reader) ParserFunc {
 	return func(reader io.Reader) (io.Reader, error) {
 		var expireAt *int64 = nil // nil means no expiration
 
@@ -352,23 +402,22 @@ func parseDb(visitor RDBVisitor) ParserFunc {
 			}
 
 			switch opcode[0] {
-			case 0xFE: // SELECTDB
+			case SELECT_DB:
 				dbNumberEnc, err := readLengthEncoded(reader)
 				if err != nil {
 					return nil, err
 				}
 				visitor.OnDBStart(dbNumberEnc.Value)
 
-			case 0xFD: // EXPIRETIME_MS
+			case EXPIRETIME: // seconds
 				buf, err := readNBytes(reader, 4)
 				if err != nil {
 					return nil, err
 				}
-				raw := binary.LittleEndian.Uint32(buf)
-				val := int64(raw)
+				val := int64(binary.LittleEndian.Uint32(buf)) * 1000
 				expireAt = &val
 
-			case 0xFC: // EXPIRETIME (seconds)
+			case EXPIRETIME_MS:
 				buf, err := readNBytes(reader, 8)
 				if err != nil {
 					return nil, err
@@ -380,7 +429,7 @@ func parseDb(visitor RDBVisitor) ParserFunc {
 				val := int64(raw)
 				expireAt = &val
 
-			case 0xFB: // RESIZEDB
+			case RESIZE_DB:
 				dbSize, err := readLengthEncoded(reader)
 				if err != nil {
 					return nil, err
@@ -391,6 +440,71 @@ func parseDb(visitor RDBVisitor) ParserFunc {
 				}
 				visitor.OnResizeDB(dbSize.Value, expireSize.Value)
 
+			case RDB_TYPE_LIST, RDB_TYPE_LIST_ZIPLIST, RDB_TYPE_LIST_QUICKLIST, RDB_TYPE_LIST_QUICKLIST_2:
+				key, err := readRdbString(reader)
+				if err != nil {
+					return nil, err
+				}
+				list, err := readList(reader, opcode[0])
+				if err != nil {
+					return nil, fmt.Errorf("failed to read list %q: %w", key, err)
+				}
+				visitor.OnList(key, list, expireAt)
+
+				expireAt = nil
+
+			case RDB_TYPE_SET, RDB_TYPE_SET_INTSET, RDB_TYPE_SET_LISTPACK:
+				key, err := readRdbString(reader)
+				if err != nil {
+					return nil, err
+				}
+				members, err := readSet(reader, opcode[0])
+				if err != nil {
+					return nil, fmt.Errorf("failed to read set %q: %w", key, err)
+				}
+				visitor.OnSet(key, members, expireAt)
+
+				expireAt = nil
+
+			case RDB_TYPE_HASH, RDB_TYPE_HASH_ZIPMAP, RDB_TYPE_HASH_ZIPLIST, RDB_TYPE_HASH_LISTPACK:
+				key, err := readRdbString(reader)
+				if err != nil {
+					return nil, err
+				}
+				hash, err := readHash(reader, opcode[0])
+				if err != nil {
+					return nil, fmt.Errorf("failed to read hash %q: %w", key, err)
+				}
+				visitor.OnHash(key, hash, expireAt)
+
+				expireAt = nil
+
+			case RDB_TYPE_ZSET, RDB_TYPE_ZSET_2, RDB_TYPE_ZSET_ZIPLIST, RDB_TYPE_ZSET_LISTPACK:
+				key, err := readRdbString(reader)
+				if err != nil {
+					return nil, err
+				}
+				zset, err := readZSet(reader, opcode[0])
+				if err != nil {
+					return nil, fmt.Errorf("failed to read sorted set %q: %w", key, err)
+				}
+				visitor.OnZSet(key, zset, expireAt)
+
+				expireAt = nil
+
+			case RDB_TYPE_STREAM_LISTPACKS, RDB_TYPE_STREAM_LISTPACKS_2, RDB_TYPE_STREAM_LISTPACKS_3:
+				key, err := readRdbString(reader)
+				if err != nil {
+					return nil, err
+				}
+				s, err := readStream(reader, opcode[0])
+				if err != nil {
+					return nil, fmt.Errorf("failed to read stream %q: %w", key, err)
+				}
+				visitor.OnStream(key, s, expireAt)
+
+				expireAt = nil
+
 			case 0x00: // String key and value
 				key, err := readRdbString(reader)
 				if err != nil {
@@ -404,12 +518,20 @@ func parseDb(visitor RDBVisitor) ParserFunc {
 
 				expireAt = nil
 
-			case 0xFF: // EOF
-				// TODO add support for checksum. for now just validate reading to buffer succufully
-				_, err := readNBytes(reader, 8)
+			case RDB_EOF:
+				// the checksum covers everything up to and including the EOF opcode
+				computed := checksum.Sum()
+				buf, err := readNBytes(reader, 8)
 				if err != nil {
 					return nil, fmt.Errorf("unable to read CRC64 checksum: %v", err)
 				}
+				expected := binary.LittleEndian.Uint64(buf)
+				if expected == 0 && skipZeroChecksum() {
+					return nil, nil
+				}
+				if expected != computed {
+					return nil, fmt.Errorf("RDB checksum mismatch: expected %016x, computed %016x", expected, computed)
+				}
 				return nil, nil
 
 			default:
@@ -430,3 +552,22 @@ func peekNBytes(reader io.Reader, n int) ([]byte, io.Reader, error) {
 	newReader := io.MultiReader(bytes.NewReader(buf), reader)
 	return buf, newReader, nil
 }
+
+func readRdbLength(reader io.Reader) (int, error) {
+	enc, err := readLengthEncoded(reader)
+	if err != nil {
+		return 0, err
+	}
+	if enc.Mode == LengthEncodingSpecial {
+		return 0, fmt.Errorf("unexpected special encoding where a length was expected")
+	}
+	return enc.Value, nil
+}
+
+func readRdbMillisecondTime(reader io.Reader) (int64, error) {
+	buf, err := readNBytes(reader, 8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(buf)), nil
+}
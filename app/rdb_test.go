@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCRC64Jones(t *testing.T) {
+	// check value of the redis crc64 implementation
+	assert.Equal(t, uint64(0xe9c6d914c4b8d9ca), crc64Jones(0, []byte("123456789")))
+}
+
+/** builds an rdb holding a single string key preceded by the given expiry opcode, with a valid checksum*/
+func rdbWithExpiry(opcode byte, expiry []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("REDIS0012")
+	buf.WriteByte(SELECT_DB)
+	buf.WriteByte(0)
+	buf.WriteByte(opcode)
+	buf.Write(expiry)
+	buf.WriteByte(RDB_TYPE_STRING)
+	writeRdbString(&buf, "key")
+	writeRdbString(&buf, "value")
+	buf.WriteByte(RDB_EOF)
+
+	checksum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(checksum, crc64Jones(0, buf.Bytes()))
+	buf.Write(checksum)
+	return buf.Bytes()
+}
+
+func TestParseRDB_ExpiryOpcodes(t *testing.T) {
+	const expireAtMillis = int64(4102444800000) // 2100-01-01
+
+	ms := make([]byte, 8)
+	binary.LittleEndian.PutUint64(ms, uint64(expireAtMillis))
+	seconds := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seconds, uint32(expireAtMillis/1000))
+
+	for name, rdb := range map[string][]byte{
+		"milliseconds": rdbWithExpiry(0xFC, ms),
+		"seconds":      rdbWithExpiry(0xFD, seconds),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s := NewInMemoryStore()
+			assert.NoError(t, parseRDB(bytes.NewReader(rdb), s))
+
+			entry, status := s.Get("key", StringEntryType)
+			assert.Equal(t, Found, status)
+			assert.Equal(t, "value", entry.Val)
+			assert.Equal(t, expireAtMillis, *entry.ExpireAt)
+		})
+	}
+}
+
+func TestParseRDB_Checksum(t *testing.T) {
+	data, err := os.ReadFile("dump.rdb")
+	assert.NoError(t, err)
+	assert.NoError(t, parseRDB(bytes.NewReader(data), NewInMemoryStore()))
+
+	corrupted := bytes.Clone(data)
+	corrupted[len(corrupted)-12] ^= 0x01
+	assert.ErrorContains(t, parseRDB(bytes.NewReader(corrupted), NewInMemoryStore()), "checksum mismatch")
+}
+
+/** an rdb without keys, as written with checksums disabled*/
+func generateEmptyRDB() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("REDIS0012")
+	buf.WriteByte(RDB_EOF)
+	buf.Write(make([]byte, 8))
+
+	return buf.Bytes()
+}
+
+func TestParseRDB_ZeroChecksumIsSkipped(t *testing.T) {
+	assert.NoError(t, parseRDB(bytes.NewReader(generateEmptyRDB()), NewInMemoryStore()))
+
+	parseFlags([]string{"your_program", FlagRdbSkipZeroChecksum, "no"})
+	defer parseFlags(nil)
+	assert.ErrorContains(t, parseRDB(bytes.NewReader(generateEmptyRDB()), NewInMemoryStore()), "checksum mismatch")
+}
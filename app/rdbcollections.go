@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// quicklist 2 node containers
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+// special lengths of the string encoded doubles used by RDB_TYPE_ZSET
+const (
+	rdbDoubleNaN    = 253
+	rdbDoublePosInf = 254
+	rdbDoubleNegInf = 255
+)
+
+/**
+ * read a list value in any of its RDB encodings (linked list, ziplist, quicklist and quicklist 2).
+ * https://github.com/redis/redis/blob/unstable/src/rdb.c rdbLoadObject
+ */
+func readList(reader io.Reader, rdbType byte) ([]string, error) {
+	switch rdbType {
+	case RDB_TYPE_LIST:
+		return readRdbStrings(reader)
+
+	case RDB_TYPE_LIST_ZIPLIST:
+		return readEncodedBlob(reader, decodeZiplist)
+
+	case RDB_TYPE_LIST_QUICKLIST, RDB_TYPE_LIST_QUICKLIST_2:
+		numNodes, err := readRdbLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		var elements []string
+		for i := 0; i < numNodes; i++ {
+			container := quicklistNodePacked
+			if rdbType == RDB_TYPE_LIST_QUICKLIST_2 {
+				if container, err = readRdbLength(reader); err != nil {
+					return nil, err
+				}
+			}
+
+			blob, err := readRdbString(reader)
+			if err != nil {
+				return nil, err
+			}
+
+			var node []string
+			switch {
+			case container == quicklistNodePlain:
+				// a single element too large to be packed
+				node = []string{blob}
+			case container != quicklistNodePacked:
+				return nil, fmt.Errorf("unknown quicklist container: %d", container)
+			case rdbType == RDB_TYPE_LIST_QUICKLIST:
+				node, err = decodeZiplist([]byte(blob))
+			default:
+				node, err = decodeListpack([]byte(blob))
+			}
+			if err != nil {
+				return nil, err
+			}
+			elements = append(elements, node...)
+		}
+		return elements, nil
+	}
+
+	return nil, fmt.Errorf("unsupported list encoding: %d", rdbType)
+}
+
+/** read a set value, as plain members, in any of its RDB encodings (hashtable, intset and listpack)*/
+func readSet(reader io.Reader, rdbType byte) ([]string, error) {
+	switch rdbType {
+	case RDB_TYPE_SET:
+		return readRdbStrings(reader)
+	case RDB_TYPE_SET_INTSET:
+		return readEncodedBlob(reader, decodeIntset)
+	case RDB_TYPE_SET_LISTPACK:
+		return readEncodedBlob(reader, decodeListpack)
+	}
+
+	return nil, fmt.Errorf("unsupported set encoding: %d", rdbType)
+}
+
+/** read a hash value in any of its RDB encodings (hashtable, zipmap, ziplist and listpack)*/
+func readHash(reader io.Reader, rdbType byte) (map[string]string, error) {
+	var pairs []string
+	var err error
+	switch rdbType {
+	case RDB_TYPE_HASH:
+		var size int
+		if size, err = readRdbLength(reader); err != nil {
+			return nil, err
+		}
+		pairs, err = readNRdbStrings(reader, size*2)
+	case RDB_TYPE_HASH_ZIPMAP:
+		pairs, err = readEncodedBlob(reader, decodeZipmap)
+	case RDB_TYPE_HASH_ZIPLIST:
+		pairs, err = readEncodedBlob(reader, decodeZiplist)
+	case RDB_TYPE_HASH_LISTPACK:
+		pairs, err = readEncodedBlob(reader, decodeListpack)
+	default:
+		return nil, fmt.Errorf("unsupported hash encoding: %d", rdbType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(pairs)%2 != 0 {
+		return nil, fmt.Errorf("hash has a field without a value")
+	}
+
+	hash := make(map[string]string, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		hash[pairs[i]] = pairs[i+1]
+	}
+	return hash, nil
+}
+
+/** read a sorted set value, as member to score, in any of its RDB encodings (skiplist, ziplist and listpack)*/
+func readZSet(reader io.Reader, rdbType byte) (map[string]float64, error) {
+	switch rdbType {
+	case RDB_TYPE_ZSET, RDB_TYPE_ZSET_2:
+		size, err := readRdbLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		zset := make(map[string]float64, size)
+		for i := 0; i < size; i++ {
+			member, err := readRdbString(reader)
+			if err != nil {
+				return nil, err
+			}
+			var score float64
+			if rdbType == RDB_TYPE_ZSET {
+				score, err = readRdbDoubleString(reader)
+			} else {
+				score, err = readRdbBinaryDouble(reader)
+			}
+			if err != nil {
+				return nil, err
+			}
+			zset[member] = score
+		}
+		return zset, nil
+
+	case RDB_TYPE_ZSET_ZIPLIST, RDB_TYPE_ZSET_LISTPACK:
+		decode := decodeZiplist
+		if rdbType == RDB_TYPE_ZSET_LISTPACK {
+			decode = decodeListpack
+		}
+		pairs, err := readEncodedBlob(reader, decode)
+		if err != nil {
+			return nil, err
+		}
+		if len(pairs)%2 != 0 {
+			return nil, fmt.Errorf("sorted set has a member without a score")
+		}
+
+		zset := make(map[string]float64, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			score, err := strconv.ParseFloat(pairs[i+1], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sorted set score %q: %w", pairs[i+1], err)
+			}
+			zset[pairs[i]] = score
+		}
+		return zset, nil
+	}
+
+	return nil, fmt.Errorf("unsupported sorted set encoding: %d", rdbType)
+}
+
+/** read a length prefixed sequence of rdb strings*/
+func readRdbStrings(reader io.Reader) ([]string, error) {
+	size, err := readRdbLength(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readNRdbStrings(reader, size)
+}
+
+func readNRdbStrings(reader io.Reader, n int) ([]string, error) {
+	values := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		value, err := readRdbString(reader)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+/** read an rdb string holding a compact encoding and decode it*/
+func readEncodedBlob(reader io.Reader, decode func([]byte) ([]string, error)) ([]string, error) {
+	blob, err := readRdbString(reader)
+	if err != nil {
+		return nil, err
+	}
+	return decode([]byte(blob))
+}
+
+/** read a double stored as a length prefixed ascii string (RDB_TYPE_ZSET)*/
+func readRdbDoubleString(reader io.Reader) (float64, error) {
+	lenByte, err := readNBytes(reader, 1)
+	if err != nil {
+		return 0, err
+	}
+
+	switch lenByte[0] {
+	case rdbDoubleNaN:
+		return math.NaN(), nil
+	case rdbDoublePosInf:
+		return math.Inf(1), nil
+	case rdbDoubleNegInf:
+		return math.Inf(-1), nil
+	}
+
+	raw, err := readStringOfLength(reader, int(lenByte[0]))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+/** read a double stored as 8 little endian IEEE 754 bytes (RDB_TYPE_ZSET_2)*/
+func readRdbBinaryDouble(reader io.Reader) (float64, error) {
+	buf, err := readNBytes(reader, 8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(buf)), nil
+}
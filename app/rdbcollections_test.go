@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/** wraps already encoded ziplist entries with prevlen fields, the header and the end marker*/
+func buildZiplist(entries ...[]byte) []byte {
+	var body bytes.Buffer
+	prevLen := 0
+	for _, entry := range entries {
+		if prevLen < ziplistBigPrevLen {
+			body.WriteByte(byte(prevLen))
+			prevLen = 1 + len(entry)
+		} else {
+			body.WriteByte(ziplistBigPrevLen)
+			binary.Write(&body, binary.LittleEndian, uint32(prevLen))
+			prevLen = 5 + len(entry)
+		}
+		body.Write(entry)
+	}
+	body.WriteByte(ziplistEnd)
+
+	header := make([]byte, ziplistHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(ziplistHeaderSize+body.Len()))
+	binary.LittleEndian.PutUint16(header[8:10], uint16(len(entries)))
+	return append(header, body.Bytes()...)
+}
+
+func TestDecodeZiplist(t *testing.T) {
+	long := bytes.Repeat([]byte("x"), 300)
+	zl := buildZiplist(
+		append([]byte{0x05}, "hello"...),
+		append([]byte{0x40 | byte(len(long)>>8), byte(len(long))}, long...),
+		[]byte{0xFE, 0xFB},             // int8 -5
+		[]byte{0xF8},                   // immediate 7
+		[]byte{0xC0, 0xE8, 0x03},       // int16 1000
+		[]byte{0xF0, 0x60, 0x79, 0xFE}, // int24 -100000
+		[]byte{0xD0, 0x00, 0xCA, 0x9A, 0x3B},
+		[]byte{0xE0, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x7F},
+	)
+
+	elements, err := decodeZiplist(zl)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hello", string(long), "-5", "7", "1000", "-100000", "1000000000", "9223372036854775807"}, elements)
+}
+
+func TestDecodeIntset(t *testing.T) {
+	data := []byte{2, 0, 0, 0, 3, 0, 0, 0, 0xFF, 0xFF, 0x01, 0x00, 0x10, 0x27}
+	members, err := decodeIntset(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-1", "1", "10000"}, members)
+
+	_, err = decodeIntset(data[:len(data)-1])
+	assert.Error(t, err)
+}
+
+func TestDecodeZipmap(t *testing.T) {
+	data := []byte{2, 3, 'f', 'o', 'o', 3, 2, 'b', 'a', 'r', 0, 0, 1, 'k', 1, 0, 'v', 0xFF}
+	pairs, err := decodeZipmap(data)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo", "bar", "k", "v"}, pairs)
+}
+
+func TestParseRDB_Collections(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("REDIS0011")
+	buf.WriteByte(SELECT_DB)
+	buf.WriteByte(0)
+
+	writeKey := func(rdbType byte, key string) {
+		buf.WriteByte(rdbType)
+		writeRdbString(&buf, key)
+	}
+
+	writeKey(RDB_TYPE_LIST_QUICKLIST_2, "list")
+	writeRdbLength(&buf, 2)
+	writeRdbLength(&buf, quicklistNodePacked)
+	writeRdbString(&buf, string(encodeListpack([]string{"a", "1"})))
+	writeRdbLength(&buf, quicklistNodePlain)
+	writeRdbString(&buf, "big")
+
+	writeKey(RDB_TYPE_LIST_ZIPLIST, "oldlist")
+	writeRdbString(&buf, string(buildZiplist([]byte{0x01, 'x'}, []byte{0xF3})))
+
+	writeKey(RDB_TYPE_SET, "set")
+	writeRdbLength(&buf, 2)
+	writeRdbString(&buf, "m1")
+	writeRdbString(&buf, "m2")
+
+	writeKey(RDB_TYPE_SET_LISTPACK, "lpset")
+	writeRdbString(&buf, string(encodeListpack([]string{"x", "5"})))
+
+	writeKey(RDB_TYPE_HASH_LISTPACK, "hash")
+	writeRdbString(&buf, string(encodeListpack([]string{"f1", "v1", "f2", "2"})))
+
+	writeKey(RDB_TYPE_HASH, "bighash")
+	writeRdbLength(&buf, 1)
+	writeRdbString(&buf, "field")
+	writeRdbString(&buf, "value")
+
+	writeKey(RDB_TYPE_ZSET_2, "zset")
+	writeRdbLength(&buf, 2)
+	writeRdbString(&buf, "one")
+	binary.Write(&buf, binary.LittleEndian, math.Float64bits(1.5))
+	writeRdbString(&buf, "inf")
+	binary.Write(&buf, binary.LittleEndian, math.Float64bits(math.Inf(1)))
+
+	writeKey(RDB_TYPE_ZSET, "oldzset")
+	writeRdbLength(&buf, 2)
+	writeRdbString(&buf, "a")
+	buf.WriteByte(3)
+	buf.WriteString("2.5")
+	writeRdbString(&buf, "b")
+	buf.WriteByte(rdbDoubleNegInf)
+
+	writeKey(RDB_TYPE_ZSET_LISTPACK, "lpzset")
+	writeRdbString(&buf, string(encodeListpack([]string{"m", "3", "n", "-0.25"})))
+
+	// int16 encoded string value
+	writeKey(RDB_TYPE_STRING, "int16")
+	buf.Write([]byte{0xC1, 0x30, 0xF8})
+
+	buf.WriteByte(RDB_EOF)
+	buf.Write(make([]byte, 8))
+
+	s := NewInMemoryStore()
+	assert.NoError(t, parseRDB(&buf, s))
+
+	get := func(key string, entryType EntryType) any {
+		entry, status := s.Get(key, entryType)
+		assert.Equal(t, Found, status, key)
+		return entry.Val
+	}
+
+	assert.Equal(t, []string{"a", "1", "big"}, get("list", ListEntryType))
+	assert.Equal(t, []string{"x", "2"}, get("oldlist", ListEntryType))
+	assert.Equal(t, map[string]struct{}{"m1": {}, "m2": {}}, get("set", SetEntryType))
+	assert.Equal(t, map[string]struct{}{"x": {}, "5": {}}, get("lpset", SetEntryType))
+	assert.Equal(t, map[string]string{"f1": "v1", "f2": "2"}, get("hash", HashEntryType))
+	assert.Equal(t, map[string]string{"field": "value"}, get("bighash", HashEntryType))
+	assert.Equal(t, map[string]float64{"one": 1.5, "inf": math.Inf(1)}, get("zset", ZSetEntryType))
+	assert.Equal(t, map[string]float64{"a": 2.5, "b": math.Inf(-1)}, get("oldzset", ZSetEntryType))
+	assert.Equal(t, map[string]float64{"m": 3, "n": -0.25}, get("lpzset", ZSetEntryType))
+	assert.Equal(t, "-2000", get("int16", StringEntryType))
+}
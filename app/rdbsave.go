@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_DB_FILENAME = "dump.rdb"
+
+var ErrBgsaveInProgress = fmt.Errorf("ERR Background save already in progress")
+
+// a failed automatic BGSAVE is retried no sooner than this, as redis does
+const bgsaveRetryDelay = 5 * time.Second
+
+const saveSchedulerInterval = 100 * time.Millisecond
+
+/** tracks SAVE/BGSAVE so only one snapshot is written at a time, and the writes since the last one*/
+type rdbSaver struct {
+	mu               sync.Mutex
+	bgsaveInProgress bool
+	lastSaveTime     time.Time
+	lastBgsaveOK     bool
+	lastBgsaveTry    time.Time
+	// writes since the last successful save
+	dirty int64
+}
+
+/** a `save <seconds> <changes>` policy entry*/
+type SavePoint struct {
+	Seconds int64
+	Changes int64
+}
+
+var rdbPersistence = &rdbSaver{lastSaveTime: time.Now(), lastBgsaveOK: true}
+
+/** the path SAVE writes to, --dir/--dbfilename with redis' defaults*/
+func rdbFilePath() string {
+	dir, exists := GetFlagValue(FlagDir)
+	if !exists {
+		dir = "."
+	}
+	dbFileName, exists := GetFlagValue(FlagDbFilename)
+	if !exists || dbFileName == "" {
+		dbFileName = DEFAULT_DB_FILENAME
+	}
+	return filepath.Join(dir, dbFileName)
+}
+
+/** write the snapshot to a temp file next to path and rename it over path, so readers never see a partial file*/
+func writeRDBFile(path string, snapshot map[string]Entry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), fmt.Sprintf("temp-%d-*.rdb", os.Getpid()))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	writer := bufio.NewWriter(tmp)
+	err = encodeRDB(writer, snapshot)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+/** SAVE: snapshot and write the dataset on the calling goroutine*/
+func (saver *rdbSaver) Save() error {
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+	if saver.bgsaveInProgress {
+		return ErrBgsaveInProgress
+	}
+
+	dirtyAtSnapshot := saver.dirty
+	if err := writeRDBFile(rdbFilePath(), store.Snapshot()); err != nil {
+		return err
+	}
+	saver.lastSaveTime = time.Now()
+	saver.dirty -= dirtyAtSnapshot
+	return nil
+}
+
+/**
+ * BGSAVE: the key space is copied before returning and written by a separate goroutine.
+ * there is no fork, the snapshot is a point in time copy instead, streams included
+ */
+func (saver *rdbSaver) BackgroundSave() error {
+	saver.mu.Lock()
+	if saver.bgsaveInProgress {
+		saver.mu.Unlock()
+		return ErrBgsaveInProgress
+	}
+	saver.bgsaveInProgress = true
+	saver.lastBgsaveTry = time.Now()
+	// writes that land after the snapshot stay counted once it is saved
+	dirtyAtSnapshot := saver.dirty
+	saver.mu.Unlock()
+
+	snapshot := store.Snapshot()
+	path := rdbFilePath()
+	go func() {
+		err := writeRDBFile(path, snapshot)
+		if err != nil {
+			log.Printf("background save failed: %v", err)
+		} else {
+			log.Println("background saving terminated with success")
+		}
+
+		saver.mu.Lock()
+		defer saver.mu.Unlock()
+		saver.bgsaveInProgress = false
+		saver.lastBgsaveOK = err == nil
+		if err == nil {
+			saver.lastSaveTime = time.Now()
+			saver.dirty -= dirtyAtSnapshot
+		}
+	}()
+	return nil
+}
+
+func (saver *rdbSaver) LastSaveTime() time.Time {
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+	return saver.lastSaveTime
+}
+
+func (saver *rdbSaver) BgsaveInProgress() bool {
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+	return saver.bgsaveInProgress
+}
+
+func (saver *rdbSaver) AddChanges(n int64) {
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+	saver.dirty += n
+}
+
+func (saver *rdbSaver) ChangesSinceLastSave() int64 {
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+	return saver.dirty
+}
+
+func (saver *rdbSaver) LastBgsaveOK() bool {
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+	return saver.lastBgsaveOK
+}
+
+/** whether any save point is met. after a failed BGSAVE the next attempt waits for bgsaveRetryDelay*/
+func (saver *rdbSaver) shouldAutoSave(points []SavePoint, now time.Time) bool {
+	saver.mu.Lock()
+	defer saver.mu.Unlock()
+
+	if saver.bgsaveInProgress {
+		return false
+	}
+	if !saver.lastBgsaveOK && now.Sub(saver.lastBgsaveTry) <= bgsaveRetryDelay {
+		return false
+	}
+
+	for _, point := range points {
+		if saver.dirty >= point.Changes && now.Sub(saver.lastSaveTime) > time.Duration(point.Seconds)*time.Second {
+			return true
+		}
+	}
+	return false
+}
+
+/** parse the save config, pairs of <seconds> <changes>. an empty value disables automatic saves*/
+func parseSavePoints(value string) ([]SavePoint, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("Invalid save parameters")
+	}
+
+	points := make([]SavePoint, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil || seconds < 1 {
+			return nil, fmt.Errorf("Invalid save parameters")
+		}
+		changes, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || changes < 0 {
+			return nil, fmt.Errorf("Invalid save parameters")
+		}
+		points = append(points, SavePoint{Seconds: seconds, Changes: changes})
+	}
+	return points, nil
+}
+
+/** check the save points periodically and start a BGSAVE when one of them is met*/
+func startSaveScheduler() {
+	go func() {
+		ticker := time.NewTicker(saveSchedulerInterval)
+		defer ticker.Stop()
+
+		loggedInvalid := ""
+		for now := range ticker.C {
+			value, _ := getConfig(ConfigSave)
+			points, err := parseSavePoints(value)
+			if err != nil {
+				if value != loggedInvalid {
+					log.Printf("ignoring invalid save config %q: %v", value, err)
+					loggedInvalid = value
+				}
+				continue
+			}
+
+			if rdbPersistence.shouldAutoSave(points, now) {
+				log.Println("save point reached, starting background save")
+				if err := rdbPersistence.BackgroundSave(); err != nil {
+					log.Printf("automatic background save failed to start: %v", err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSavePoints(t *testing.T) {
+	points, err := parseSavePoints("900 1 300 10")
+	assert.NoError(t, err)
+	assert.Equal(t, []SavePoint{{Seconds: 900, Changes: 1}, {Seconds: 300, Changes: 10}}, points)
+
+	points, err = parseSavePoints("")
+	assert.NoError(t, err)
+	assert.Empty(t, points)
+
+	for _, invalid := range []string{"900", "900 x", "0 1", "60 -1"} {
+		_, err := parseSavePoints(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestShouldAutoSave(t *testing.T) {
+	now := time.Now()
+	saver := &rdbSaver{lastSaveTime: now.Add(-time.Minute), lastBgsaveOK: true}
+	points := []SavePoint{{Seconds: 3600, Changes: 1}, {Seconds: 30, Changes: 10}}
+
+	saver.AddChanges(9)
+	assert.False(t, saver.shouldAutoSave(points, now))
+	saver.AddChanges(1)
+	assert.True(t, saver.shouldAutoSave(points, now))
+	assert.False(t, saver.shouldAutoSave(nil, now))
+
+	// a failed bgsave is not retried right away
+	saver.lastBgsaveOK = false
+	saver.lastBgsaveTry = now.Add(-time.Second)
+	assert.False(t, saver.shouldAutoSave(points, now))
+	saver.lastBgsaveTry = now.Add(-2 * bgsaveRetryDelay)
+	assert.True(t, saver.shouldAutoSave(points, now))
+}
+
+func TestConfigSetSave(t *testing.T) {
+	defer delete(configOverrides, ConfigSave)
+
+	assert.Equal(t, "OK", execute(NewConfigCommand, "CONFIG", "SET", "save", "900 1 300 10").String)
+	resp := execute(NewConfigCommand, "CONFIG", "GET", "save")
+	assert.Equal(t, "900 1 300 10", resp.Array[1].String)
+
+	resp = execute(NewConfigCommand, "CONFIG", "SET", "save", "900")
+	assert.Equal(t, Error, resp.Type)
+	resp = execute(NewConfigCommand, "CONFIG", "SET", "no-such-option", "1")
+	assert.Equal(t, Error, resp.Type)
+}
+
+func TestInfoPersistence(t *testing.T) {
+	resp := execute(NewInfoCommand, "INFO", "persistence")
+	assert.True(t, strings.HasPrefix(resp.String, "# Persistence"))
+	assert.Contains(t, resp.String, "rdb_changes_since_last_save:")
+	assert.Contains(t, resp.String, "rdb_last_bgsave_status:ok")
+	assert.Contains(t, resp.String, "rdb_last_save_time:")
+	assert.NotContains(t, resp.String, "# Replication")
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+)
+
+// stream listpack entry flags
+const (
+	streamItemFlagDeleted    = 1 << 0
+	streamItemFlagSameFields = 1 << 1
+)
+
+/**
+ * read a stream value in any of the listpack based RDB encodings (types 15, 19 and 21).
+ * https://github.com/redis/redis/blob/unstable/src/rdb.c rdbLoadObject
+ */
+func readStream(reader io.Reader, rdbType byte) (*stream.Stream, error) {
+	s := stream.NewStream()
+
+	numNodes, err := readRdbLength(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < numNodes; i++ {
+		masterKey, err := readRdbString(reader)
+		if err != nil {
+			return nil, err
+		}
+		if len(masterKey) != 16 {
+			return nil, fmt.Errorf("invalid stream node key length: %d", len(masterKey))
+		}
+		lp, err := readRdbString(reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := readStreamListpack(s, decodeRawStreamID([]byte(masterKey)), []byte(lp)); err != nil {
+			return nil, err
+		}
+	}
+
+	// the stream length is implied by the entries
+	if _, err := readRdbLength(reader); err != nil {
+		return nil, err
+	}
+	lastID, err := readRdbStreamID(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	maxDeletedID := stream.MinID
+	entriesAdded := int64(s.Len())
+	if rdbType >= RDB_TYPE_STREAM_LISTPACKS_2 {
+		// the first id is implied by the entries as well
+		if _, err := readRdbStreamID(reader); err != nil {
+			return nil, err
+		}
+		if maxDeletedID, err = readRdbStreamID(reader); err != nil {
+			return nil, err
+		}
+		added, err := readRdbLength(reader)
+		if err != nil {
+			return nil, err
+		}
+		entriesAdded = int64(added)
+	}
+	s.RestoreMeta(lastID, maxDeletedID, entriesAdded)
+
+	numGroups, err := readRdbLength(reader)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < numGroups; i++ {
+		group, err := readStreamGroup(reader, rdbType)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.RestoreGroup(group); err != nil {
+			return nil, fmt.Errorf("duplicated consumer group %q: %w", group.Name, err)
+		}
+	}
+
+	return s, nil
+}
+
+/**
+ * decode the entries of a single stream node. the listpack starts with a master entry:
+ * count, deleted, num-fields, field names..., 0
+ * followed by the entries: flags, ms-diff, seq-diff, [num-fields, field, value... | values...], lp-count
+ */
+func readStreamListpack(s *stream.Stream, master stream.StreamID, lp []byte) error {
+	elements, err := decodeListpack(lp)
+	if err != nil {
+		return err
+	}
+
+	pos := 0
+	next := func() (string, error) {
+		if pos >= len(elements) {
+			return "", fmt.Errorf("stream listpack truncated")
+		}
+		pos++
+		return elements[pos-1], nil
+	}
+	nextInt := func() (int64, error) {
+		element, err := next()
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(element, 10, 64)
+	}
+
+	if _, err := nextInt(); err != nil { // count
+		return err
+	}
+	if _, err := nextInt(); err != nil { // deleted
+		return err
+	}
+	numMasterFields, err := nextInt()
+	if err != nil {
+		return err
+	}
+	masterFields := make([]string, numMasterFields)
+	for i := range masterFields {
+		if masterFields[i], err = next(); err != nil {
+			return err
+		}
+	}
+	if _, err := nextInt(); err != nil { // master entry terminator
+		return err
+	}
+
+	for pos < len(elements) {
+		flags, err := nextInt()
+		if err != nil {
+			return err
+		}
+		msDiff, err := nextInt()
+		if err != nil {
+			return err
+		}
+		seqDiff, err := nextInt()
+		if err != nil {
+			return err
+		}
+
+		var fields []stream.StreamField
+		if flags&streamItemFlagSameFields != 0 {
+			for _, name := range masterFields {
+				value, err := next()
+				if err != nil {
+					return err
+				}
+				fields = append(fields, stream.StreamField{Name: name, Value: value})
+			}
+		} else {
+			numFields, err := nextInt()
+			if err != nil {
+				return err
+			}
+			for j := int64(0); j < numFields; j++ {
+				name, err := next()
+				if err != nil {
+					return err
+				}
+				value, err := next()
+				if err != nil {
+					return err
+				}
+				fields = append(fields, stream.StreamField{Name: name, Value: value})
+			}
+		}
+
+		if _, err := nextInt(); err != nil { // lp-count
+			return err
+		}
+
+		if flags&streamItemFlagDeleted != 0 {
+			continue
+		}
+		s.RestoreEntry(stream.StreamEntry{
+			ID:     stream.StreamID{Timestamp: master.Timestamp + msDiff, Sequence: master.Sequence + seqDiff},
+			Fields: fields,
+		})
+	}
+
+	return nil
+}
+
+func readStreamGroup(reader io.Reader, rdbType byte) (stream.GroupInfo, error) {
+	group := stream.GroupInfo{EntriesRead: stream.InvalidEntriesRead}
+
+	var err error
+	if group.Name, err = readRdbString(reader); err != nil {
+		return group, err
+	}
+	if group.LastDeliveredID, err = readRdbStreamID(reader); err != nil {
+		return group, err
+	}
+	if rdbType >= RDB_TYPE_STREAM_LISTPACKS_2 {
+		entriesRead, err := readRdbLength(reader)
+		if err != nil {
+			return group, err
+		}
+		group.EntriesRead = int64(entriesRead)
+	}
+
+	// the group pending list holds the delivery info, the consumers only list the ids they own
+	numPending, err := readRdbLength(reader)
+	if err != nil {
+		return group, err
+	}
+	for i := 0; i < numPending; i++ {
+		rawID, err := readNBytes(reader, 16)
+		if err != nil {
+			return group, err
+		}
+		deliveryTime, err := readRdbMillisecondTime(reader)
+		if err != nil {
+			return group, err
+		}
+		deliveryCount, err := readRdbLength(reader)
+		if err != nil {
+			return group, err
+		}
+		group.Pending = append(group.Pending, stream.PendingEntry{
+			ID:            decodeRawStreamID(rawID),
+			DeliveryTime:  deliveryTime,
+			DeliveryCount: int64(deliveryCount),
+		})
+	}
+
+	numConsumers, err := readRdbLength(reader)
+	if err != nil {
+		return group, err
+	}
+	for i := 0; i < numConsumers; i++ {
+		consumer := stream.ConsumerInfo{}
+		if consumer.Name, err = readRdbString(reader); err != nil {
+			return group, err
+		}
+		if consumer.SeenTime, err = readRdbMillisecondTime(reader); err != nil {
+			return group, err
+		}
+		consumer.ActiveTime = consumer.SeenTime
+		if rdbType >= RDB_TYPE_STREAM_LISTPACKS_3 {
+			if consumer.ActiveTime, err = readRdbMillisecondTime(reader); err != nil {
+				return group, err
+			}
+		}
+
+		numOwned, err := readRdbLength(reader)
+		if err != nil {
+			return group, err
+		}
+		for j := 0; j < numOwned; j++ {
+			rawID, err := readNBytes(reader, 16)
+			if err != nil {
+				return group, err
+			}
+			consumer.Pending = append(consumer.Pending, stream.PendingEntry{ID: decodeRawStreamID(rawID)})
+		}
+		group.Consumers = append(group.Consumers, consumer)
+	}
+
+	return group, nil
+}
+
+/**
+ * write a stream value in the RDB_TYPE_STREAM_LISTPACKS_3 encoding, without the type byte.
+ * entries are packed in nodes of stream.NodeMaxEntries entries, the first entry of each
+ * node is its master entry.
+ */
+func writeStream(writer io.Writer, s *stream.Stream) error {
+	info := s.Info(true, 0)
+
+	var buf bytes.Buffer
+	numNodes := (len(info.Entries) + stream.NodeMaxEntries - 1) / stream.NodeMaxEntries
+	writeRdbLength(&buf, uint64(numNodes))
+	for start := 0; start < len(info.Entries); start += stream.NodeMaxEntries {
+		end := min(start+stream.NodeMaxEntries, len(info.Entries))
+		node := info.Entries[start:end]
+		writeRdbString(&buf, string(encodeRawStreamID(node[0].ID)))
+		writeRdbString(&buf, string(encodeStreamListpack(node)))
+	}
+
+	writeRdbLength(&buf, uint64(info.Length))
+	writeRdbStreamID(&buf, info.LastGeneratedID)
+	writeRdbStreamID(&buf, info.RecordedFirstID)
+	writeRdbStreamID(&buf, info.MaxDeletedID)
+	writeRdbLength(&buf, uint64(info.EntriesAdded))
+
+	writeRdbLength(&buf, uint64(len(info.Groups)))
+	for _, group := range info.Groups {
+		writeRdbString(&buf, group.Name)
+		writeRdbStreamID(&buf, group.LastDeliveredID)
+		// an unknown counter (-1) is stored as the max 64 bit length, as Redis does
+		writeRdbLength(&buf, uint64(group.EntriesRead))
+
+		writeRdbLength(&buf, uint64(len(group.Pending)))
+		for _, pendingEntry := range group.Pending {
+			buf.Write(encodeRawStreamID(pendingEntry.ID))
+			writeRdbMillisecondTime(&buf, pendingEntry.DeliveryTime)
+			writeRdbLength(&buf, uint64(pendingEntry.DeliveryCount))
+		}
+
+		writeRdbLength(&buf, uint64(len(group.Consumers)))
+		for _, consumer := range group.Consumers {
+			writeRdbString(&buf, consumer.Name)
+			writeRdbMillisecondTime(&buf, consumer.SeenTime)
+			writeRdbMillisecondTime(&buf, consumer.ActiveTime)
+			writeRdbLength(&buf, uint64(len(consumer.Pending)))
+			for _, pendingEntry := range consumer.Pending {
+				buf.Write(encodeRawStreamID(pendingEntry.ID))
+			}
+		}
+	}
+
+	_, err := writer.Write(buf.Bytes())
+	return err
+}
+
+func encodeStreamListpack(entries []stream.StreamEntry) []byte {
+	master := entries[0]
+	elements := []string{
+		strconv.Itoa(len(entries)),
+		"0",
+		strconv.Itoa(len(master.Fields)),
+	}
+	for _, field := range master.Fields {
+		elements = append(elements, field.Name)
+	}
+	elements = append(elements, "0")
+
+	for _, entry := range entries {
+		sameFields := len(entry.Fields) == len(master.Fields)
+		for i := 0; sameFields && i < len(entry.Fields); i++ {
+			sameFields = entry.Fields[i].Name == master.Fields[i].Name
+		}
+
+		flags := 0
+		if sameFields {
+			flags = streamItemFlagSameFields
+		}
+		elements = append(elements,
+			strconv.Itoa(flags),
+			strconv.FormatInt(entry.ID.Timestamp-master.ID.Timestamp, 10),
+			strconv.FormatInt(entry.ID.Sequence-master.ID.Sequence, 10),
+		)
+
+		lpCount := len(entry.Fields) + 3
+		if sameFields {
+			for _, field := range entry.Fields {
+				elements = append(elements, field.Value)
+			}
+		} else {
+			elements = append(elements, strconv.Itoa(len(entry.Fields)))
+			for _, field := range entry.Fields {
+				elements = append(elements, field.Name, field.Value)
+			}
+			lpCount += len(entry.Fields) + 1
+		}
+		elements = append(elements, strconv.Itoa(lpCount))
+	}
+
+	return encodeListpack(elements)
+}
+
+func readRdbStreamID(reader io.Reader) (stream.StreamID, error) {
+	ms, err := readRdbLength(reader)
+	if err != nil {
+		return stream.StreamID{}, err
+	}
+	seq, err := readRdbLength(reader)
+	if err != nil {
+		return stream.StreamID{}, err
+	}
+	return stream.StreamID{Timestamp: int64(ms), Sequence: int64(seq)}, nil
+}
+
+func writeRdbStreamID(buf *bytes.Buffer, id stream.StreamID) {
+	writeRdbLength(buf, uint64(id.Timestamp))
+	writeRdbLength(buf, uint64(id.Sequence))
+}
+
+/** stream ids are stored raw as 128 bit big endian (ms, seq) in node keys and pending lists*/
+func decodeRawStreamID(raw []byte) stream.StreamID {
+	return stream.StreamID{
+		Timestamp: int64(binary.BigEndian.Uint64(raw[:8])),
+		Sequence:  int64(binary.BigEndian.Uint64(raw[8:16])),
+	}
+}
+
+func encodeRawStreamID(id stream.StreamID) []byte {
+	raw := make([]byte, 16)
+	binary.BigEndian.PutUint64(raw[:8], uint64(id.Timestamp))
+	binary.BigEndian.PutUint64(raw[8:], uint64(id.Sequence))
+	return raw
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListpack_RoundTrip(t *testing.T) {
+	elements := []string{
+		"0", "127", "128", "-1", "-4096", "4095", "-32768", "32767", "8388607", "-8388608",
+		"2147483647", "-2147483648", "9223372036854775807", "-9223372036854775808",
+		"", "hello", "007", "+1", strings.Repeat("x", 63), strings.Repeat("y", 64),
+		strings.Repeat("z", 4095), strings.Repeat("w", 4096), strings.Repeat("v", 20000),
+	}
+
+	decoded, err := decodeListpack(encodeListpack(elements))
+	assert.NoError(t, err)
+	assert.Equal(t, elements, decoded)
+}
+
+func TestStreamRDB_RoundTrip(t *testing.T) {
+	s := stream.NewStream()
+	for i := 1; i <= 250; i++ {
+		fields := []stream.StreamField{{Name: "temp", Value: fmt.Sprintf("%d", i)}}
+		if i%7 == 0 {
+			fields = append(fields, stream.StreamField{Name: "extra", Value: "yes"})
+		}
+		_, err := s.Add(fmt.Sprintf("%d-%d", 1000+i, i%3), fields)
+		assert.NoError(t, err)
+	}
+	s.Delete([]stream.StreamID{{Timestamp: 1010, Sequence: 1}})
+	assert.NoError(t, s.CreateGroup("workers", stream.MinID, stream.InvalidEntriesRead))
+	_, err := s.ReadGroupNew("workers", "alice", 3, false)
+	assert.NoError(t, err)
+	_, err = s.ReadGroupNew("workers", "bob", 2, false)
+	assert.NoError(t, err)
+	_, err = s.CreateConsumer("workers", "idle")
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, writeStream(&buf, s))
+
+	loaded, err := readStream(&buf, RDB_TYPE_STREAM_LISTPACKS_3)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, buf.Len())
+
+	assert.Equal(t, s.Range(stream.MinID, stream.MaxID, 0, false), loaded.Range(stream.MinID, stream.MaxID, 0, false))
+
+	want, got := s.Info(true, 0), loaded.Info(true, 0)
+	assert.Equal(t, want.LastGeneratedID, got.LastGeneratedID)
+	assert.Equal(t, want.MaxDeletedID, got.MaxDeletedID)
+	assert.Equal(t, want.EntriesAdded, got.EntriesAdded)
+	assert.Equal(t, want.Groups, got.Groups)
+}
@@ -1,12 +1,21 @@
 package main
 
-import "log"
+import (
+	"log"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+)
 
 type RDBVisitor interface {
 	OnHeader(version int)
 	OnAuxField(key, value string)
 	OnDBStart(dbIndex int)
 	OnEntry(key, value string, ttlMillis *int64)
+	OnStream(key string, value *stream.Stream, ttlMillis *int64)
+	OnList(key string, value []string, ttlMillis *int64)
+	OnSet(key string, members []string, ttlMillis *int64)
+	OnHash(key string, value map[string]string, ttlMillis *int64)
+	OnZSet(key string, value map[string]float64, ttlMillis *int64)
 	OnResizeDB(dbResize int, expireSize int)
 }
 
@@ -41,7 +50,57 @@ func (visitor *RDBStoreVisitor) OnEntry(key, value string, ttlMillis *int64) {
 	entry := Entry{
 		Val:      value,
 		ExpireAt: ttlMillis,
+		Type:     StringEntryType,
 	}
 
 	visitor.store.Set(key, entry)
 }
+
+func (visitor *RDBStoreVisitor) OnStream(key string, value *stream.Stream, ttlMillis *int64) {
+	log.Printf("DB %d: stream key: %s, entries: %d\n", visitor.db, key, value.Len())
+	visitor.store.Set(key, Entry{
+		Val:      value,
+		ExpireAt: ttlMillis,
+		Type:     StreamEntryType,
+	})
+}
+
+func (visitor *RDBStoreVisitor) OnList(key string, value []string, ttlMillis *int64) {
+	log.Printf("DB %d: list key: %s, length: %d\n", visitor.db, key, len(value))
+	visitor.store.Set(key, Entry{
+		Val:      value,
+		ExpireAt: ttlMillis,
+		Type:     ListEntryType,
+	})
+}
+
+func (visitor *RDBStoreVisitor) OnSet(key string, members []string, ttlMillis *int64) {
+	log.Printf("DB %d: set key: %s, members: %d\n", visitor.db, key, len(members))
+	set := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+	visitor.store.Set(key, Entry{
+		Val:      set,
+		ExpireAt: ttlMillis,
+		Type:     SetEntryType,
+	})
+}
+
+func (visitor *RDBStoreVisitor) OnHash(key string, value map[string]string, ttlMillis *int64) {
+	log.Printf("DB %d: hash key: %s, fields: %d\n", visitor.db, key, len(value))
+	visitor.store.Set(key, Entry{
+		Val:      value,
+		ExpireAt: ttlMillis,
+		Type:     HashEntryType,
+	})
+}
+
+func (visitor *RDBStoreVisitor) OnZSet(key string, value map[string]float64, ttlMillis *int64) {
+	log.Printf("DB %d: sorted set key: %s, members: %d\n", visitor.db, key, len(value))
+	visitor.store.Set(key, Entry{
+		Val:      value,
+		ExpireAt: ttlMillis,
+		Type:     ZSetEntryType,
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+)
+
+const RDB_REDIS_VERSION = "7.4.0"
+
+/**
+ * encode a snapshot of the store as a complete RDB file: header, aux fields, a single db with
+ * its RESIZEDB hint, every key with its expiry, and the EOF marker followed by the CRC64 of everything before it
+ */
+func encodeRDB(writer io.Writer, snapshot map[string]Entry) error {
+	out := newCRC64Writer(writer)
+
+	var buf bytes.Buffer
+	buf.WriteString(RDB_MAGIC_STRING + RDB_VERSION)
+	writeRdbAuxField(&buf, "redis-ver", RDB_REDIS_VERSION)
+	writeRdbAuxField(&buf, "redis-bits", strconv.Itoa(strconv.IntSize))
+	writeRdbAuxField(&buf, "ctime", strconv.FormatInt(time.Now().Unix(), 10))
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	writeRdbAuxField(&buf, "used-mem", strconv.FormatUint(mem.Alloc, 10))
+
+	keys := make([]string, 0, len(snapshot))
+	expires := 0
+	for key, entry := range snapshot {
+		keys = append(keys, key)
+		if entry.ExpireAt != nil {
+			expires++
+		}
+	}
+	sort.Strings(keys)
+
+	if len(keys) > 0 {
+		buf.WriteByte(SELECT_DB)
+		writeRdbLength(&buf, 0)
+		buf.WriteByte(RESIZE_DB)
+		writeRdbLength(&buf, uint64(len(keys)))
+		writeRdbLength(&buf, uint64(expires))
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		buf.Reset()
+		if err := writeRdbEntry(&buf, key, snapshot[key]); err != nil {
+			return err
+		}
+		if _, err := out.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := out.Write([]byte{RDB_EOF}); err != nil {
+		return err
+	}
+	_, err := writer.Write(binary.LittleEndian.AppendUint64(nil, out.Sum()))
+	return err
+}
+
+func writeRdbAuxField(buf *bytes.Buffer, key, value string) {
+	buf.WriteByte(AUXILIARY_FIELD)
+	writeRdbString(buf, key)
+	writeRdbString(buf, value)
+}
+
+/** write a single key: its optional expiry, value type, name and value*/
+func writeRdbEntry(buf *bytes.Buffer, key string, entry Entry) error {
+	if entry.ExpireAt != nil {
+		buf.WriteByte(EXPIRETIME_MS)
+		writeRdbMillisecondTime(buf, *entry.ExpireAt)
+	}
+
+	switch value := entry.Val.(type) {
+	case string:
+		buf.WriteByte(RDB_TYPE_STRING)
+		writeRdbString(buf, key)
+		writeRdbString(buf, value)
+
+	case []string:
+		buf.WriteByte(RDB_TYPE_LIST)
+		writeRdbString(buf, key)
+		writeRdbLength(buf, uint64(len(value)))
+		for _, element := range value {
+			writeRdbString(buf, element)
+		}
+
+	case map[string]struct{}:
+		buf.WriteByte(RDB_TYPE_SET)
+		writeRdbString(buf, key)
+		writeRdbLength(buf, uint64(len(value)))
+		for member := range value {
+			writeRdbString(buf, member)
+		}
+
+	case map[string]string:
+		buf.WriteByte(RDB_TYPE_HASH)
+		writeRdbString(buf, key)
+		writeRdbLength(buf, uint64(len(value)))
+		for field, fieldValue := range value {
+			writeRdbString(buf, field)
+			writeRdbString(buf, fieldValue)
+		}
+
+	case map[string]float64:
+		buf.WriteByte(RDB_TYPE_ZSET_2)
+		writeRdbString(buf, key)
+		writeRdbLength(buf, uint64(len(value)))
+		for member, score := range value {
+			writeRdbString(buf, member)
+			buf.Write(binary.LittleEndian.AppendUint64(nil, math.Float64bits(score)))
+		}
+
+	case *stream.Stream:
+		buf.WriteByte(RDB_TYPE_STREAM_LISTPACKS_3)
+		writeRdbString(buf, key)
+		return writeStream(buf, value)
+
+	default:
+		return fmt.Errorf("unable to encode key %q of type %s", key, entry.Type)
+	}
+	return nil
+}
+
+/** write a RDB length encoded integer, the inverse of readLengthEncoded*/
+func writeRdbLength(buf *bytes.Buffer, length uint64) {
+	switch {
+	case length < 1<<6:
+		buf.WriteByte(byte(length))
+	case length < 1<<14:
+		buf.WriteByte(byte(length>>8) | 0x40)
+		buf.WriteByte(byte(length))
+	case length <= 0xFFFFFFFF:
+		buf.WriteByte(RDB_32BIT_LEN)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(length)))
+	default:
+		buf.WriteByte(RDB_64BIT_LEN)
+		buf.Write(binary.BigEndian.AppendUint64(nil, length))
+	}
+}
+
+/** write a plain (not int encoded, not compressed) RDB string*/
+func writeRdbString(buf *bytes.Buffer, value string) {
+	writeRdbLength(buf, uint64(len(value)))
+	buf.WriteString(value)
+}
+
+func writeRdbMillisecondTime(buf *bytes.Buffer, millis int64) {
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(millis)))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeRDB_RoundTrip(t *testing.T) {
+	expireAt := time.Now().Add(time.Hour).UnixMilli()
+	s := stream.NewStream()
+	_, err := s.Add("1-1", []stream.StreamField{{Name: "f", Value: "v"}})
+	assert.NoError(t, err)
+
+	snapshot := map[string]Entry{
+		"string":  {Val: "value", Type: StringEntryType},
+		"expires": {Val: "soon", ExpireAt: &expireAt, Type: StringEntryType},
+		"list":    {Val: []string{"a", "b", "a"}, Type: ListEntryType},
+		"set":     {Val: map[string]struct{}{"x": {}, "y": {}}, Type: SetEntryType},
+		"hash":    {Val: map[string]string{"f": "v"}, Type: HashEntryType},
+		"zset":    {Val: map[string]float64{"m": -1.25}, Type: ZSetEntryType},
+		"stream":  {Val: s, Type: StreamEntryType},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, encodeRDB(&buf, snapshot))
+
+	loaded := NewInMemoryStore()
+	assert.NoError(t, parseRDB(bytes.NewReader(buf.Bytes()), loaded))
+
+	got := loaded.Snapshot()
+	assert.Len(t, got, len(snapshot))
+	for key, want := range snapshot {
+		if key == "stream" {
+			continue
+		}
+		assert.Equal(t, want, got[key], key)
+	}
+	assert.Equal(t, s.Range(stream.MinID, stream.MaxID, 0, false),
+		got["stream"].Val.(*stream.Stream).Range(stream.MinID, stream.MaxID, 0, false))
+
+	// a single flipped bit is caught by the checksum
+	corrupted := bytes.Clone(buf.Bytes())
+	corrupted[len(corrupted)-10] ^= 0x01
+	assert.Error(t, parseRDB(bytes.NewReader(corrupted), NewInMemoryStore()))
+}
+
+func TestSaveAndBgSaveCommands(t *testing.T) {
+	dir := t.TempDir()
+	parseFlags([]string{"your_program", FlagDir, dir, FlagDbFilename, "test.rdb"})
+	defer parseFlags(nil)
+
+	ResetStore()
+	store.Set("k", Entry{Val: "v1", Type: StringEntryType})
+
+	before := time.Now().Unix()
+	assert.Equal(t, "OK", execute(NewSaveCommand, "SAVE").String)
+	assert.GreaterOrEqual(t, execute(NewLastSaveCommand, "LASTSAVE").Integer, before)
+
+	loaded := NewInMemoryStore()
+	assert.NoError(t, LoadRDBFile(dir, "test.rdb", loaded))
+	entry, status := loaded.Get("k", StringEntryType)
+	assert.Equal(t, Found, status)
+	assert.Equal(t, "v1", entry.Val)
+
+	store.Set("k", Entry{Val: "v2", Type: StringEntryType})
+	assert.Equal(t, "Background saving started", execute(NewBgSaveCommand, "BGSAVE").String)
+	assert.Eventually(t, func() bool { return !rdbPersistence.BgsaveInProgress() }, time.Second, 5*time.Millisecond)
+
+	loaded = NewInMemoryStore()
+	assert.NoError(t, LoadRDBFile(dir, "test.rdb", loaded))
+	entry, _ = loaded.Get("k", StringEntryType)
+	assert.Equal(t, "v2", entry.Val)
+
+	// only the renamed file is left behind
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, "test.rdb")}, files)
+}
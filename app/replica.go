@@ -12,36 +12,96 @@ var (
 	connectedReplicas sync.Map
 )
 
-var totalBytes atomic.Int64
+var (
+	// serializes propagation, so the master offset, the backlog and every replica stream agree on the byte order
+	replicationMu sync.Mutex
+	// created with the first replica, the master offset only advances once there is one (as in redis)
+	replBacklog      *replicationBacklog
+	masterReplOffset atomic.Int64
+)
 
-func registerReplica(conn net.Conn) {
+/** the backlog, created on first use. caller holds replicationMu*/
+func ensureReplicationBacklog() *replicationBacklog {
+	if replBacklog == nil {
+		replBacklog = newReplicationBacklog(replBacklogSize(), masterReplOffset.Load())
+	}
+	return replBacklog
+}
 
-	connectedReplicas.Store(conn, &ReplicaState{
-		Conn: conn,
-		Addr: conn.RemoteAddr().String(),
-	})
+func replBacklogSize() int {
+	size, _ := getConfig(ConfigReplBacklogSize)
+	bytes, _ := parseMemorySize(size)
+	return int(bytes)
+}
+
+func resizeReplicationBacklog(size int64) {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	if replBacklog != nil {
+		replBacklog = replBacklog.resized(int(size))
+	}
+}
+
+/**
+ * register a replica that is being synced, starting at the given master offset.
+ * propagated writes are buffered until it goes online. caller holds replicationMu
+ */
+func registerReplica(conn net.Conn, listeningPort int, offset int64) *ReplicaState {
+	state := &ReplicaState{
+		Conn:          conn,
+		Addr:          conn.RemoteAddr().String(),
+		PendingOffset: offset,
+		ListeningPort: listeningPort,
+	}
+	connectedReplicas.Store(conn, state)
 
 	log.Printf("Registered replica: %s\n", conn.RemoteAddr().String())
-	// TODO rethink of the monitor mechanism - temporary disable
-	//monitorReplicaConnection(conn)
+	return state
 }
 
-func monitorReplicaConnection(conn net.Conn) {
+const replicationCronInterval = time.Second
+
+/**
+ * master side heartbeat: every repl-ping-replica-period a PING goes down the replication stream, so replicas
+ * can tell a quiet master from a dead one, and replicas that did not ACK within repl-timeout are dropped.
+ * the PING is part of the stream like any write, which keeps the offsets WAIT compares in step
+ */
+func startReplicationCron() {
 	go func() {
-		ticker := time.NewTicker(60 * time.Second)
+		ticker := time.NewTicker(replicationCronInterval)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			err := sendAckToReplica(conn)
-			if err != nil {
-				log.Printf("Replica %v is unreachable (ping failed): %v", conn.RemoteAddr(), err)
-				unregisterReplica(conn)
-				return
+		var lastPing time.Time
+		for now := range ticker.C {
+			if getRole() != "master" {
+				// the stream is our master's, it pings for us
+				continue
+			}
+
+			timeout := time.Duration(getIntConfig(ConfigReplTimeout)) * time.Second
+			dropTimedOutReplicas(now, timeout)
+
+			pingPeriod := time.Duration(getIntConfig(ConfigReplPingReplicaPeriod)) * time.Second
+			if now.Sub(lastPing) >= pingPeriod && len(GetAllConnectedReplicas()) > 0 {
+				lastPing = now
+				broadcastToReplicas(RESPValue{Type: Array, Array: []RESPValue{{Type: BulkString, String: CommandPING}}})
 			}
 		}
 	}()
 }
 
+func dropTimedOutReplicas(now time.Time, timeout time.Duration) {
+	for _, replica := range GetAllConnectedReplicas() {
+		replica.Mu.Lock()
+		timedOut := replica.online && now.Sub(replica.LastAckTime) > timeout
+		replica.Mu.Unlock()
+		if timedOut {
+			log.Printf("replica %s timed out, no ACK for %s", replica.Addr, timeout)
+			unregisterReplica(replica.Conn)
+		}
+	}
+}
+
 func GetAllConnectedReplicas() []*ReplicaState {
 	var replicasState []*ReplicaState
 
@@ -64,73 +124,179 @@ func unregisterReplica(conn net.Conn) {
 	}
 }
 
-func broadcastToReplicas(resp RESPValue) {
+/** drop the link to every replica, they reconnect and resync*/
+func disconnectReplicas() {
+	connectedReplicas.Range(func(key, _ any) bool {
+		unregisterReplica(key.(net.Conn))
+		return true
+	})
+}
+
+/** propagate a command to every replica, returning the master offset right after it*/
+func broadcastToReplicas(resp RESPValue) int64 {
 	data, err := resp.Serialize()
 	if err != nil {
 		log.Println("Failed to serialize command:", err)
-		return
+		return masterReplOffset.Load()
 	}
 
-	newOffset := totalBytes.Add(int64(len(data)))
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+	if replBacklog == nil {
+		// no replica ever connected, there is nobody to propagate to
+		return masterReplOffset.Load()
+	}
+	replBacklog.feed(data)
+	newOffset := replBacklog.offset
+	masterReplOffset.Store(newOffset)
 
 	connectedReplicas.Range(func(key, value any) bool {
 		conn := key.(net.Conn)
 		state := value.(*ReplicaState)
 
-		if _, err := conn.Write(data); err != nil {
+		if err := state.propagate(data, newOffset); err != nil {
 			log.Printf("Replica write failed: %v — removing", err)
 			unregisterReplica(conn)
-			return true // continue with next replica
 		}
-
-		state.PendingOffset = newOffset
-		return true
+		return true // continue with next replica
 	})
+	return newOffset
 }
 
-func sendAckToReplica(conn net.Conn) error {
-	log.Println("sending REPLCONF GETACK * to replica")
-	_, err := conn.Write([]byte("*3\r\n$8\r\nREPLCONF\r\n$6\r\nGETACK\r\n$1\r\n*\r\n"))
-	if err != nil {
-		log.Printf("Failed to send REPLCONF GETACK *: %v", err)
-		return err
+/** write a propagated command to the replica, or buffer it while the replica is still receiving its snapshot*/
+func (replicaState *ReplicaState) propagate(data []byte, offset int64) error {
+	replicaState.Mu.Lock()
+	defer replicaState.Mu.Unlock()
+
+	replicaState.PendingOffset = offset
+	if !replicaState.online {
+		replicaState.buffer = append(replicaState.buffer, data...)
+		return nil
 	}
+	_, err := replicaState.Conn.Write(data)
+	return err
+}
+
+/** the snapshot was transferred: send what was buffered meanwhile and propagate directly from now on*/
+func (replicaState *ReplicaState) goOnline() error {
+	replicaState.Mu.Lock()
+	defer replicaState.Mu.Unlock()
 
+	if len(replicaState.buffer) > 0 {
+		if _, err := replicaState.Conn.Write(replicaState.buffer); err != nil {
+			return err
+		}
+	}
+	replicaState.buffer = nil
+	replicaState.online = true
+	// the replica had no chance to ACK while loading, its timeout starts now
+	replicaState.LastAckTime = time.Now()
 	return nil
 }
 
 type ReplicaState struct {
-	Conn           net.Conn
-	Addr           string
-	LastAckOffset  int64
-	PendingOffset  int64
-	LastAckRequest time.Time
-	Mu             sync.Mutex
+	Conn          net.Conn
+	Addr          string
+	LastAckOffset int64
+	PendingOffset int64
+	// when the replica last sent REPLCONF ACK, replicas send one every second
+	LastAckTime time.Time
+	Mu          sync.Mutex
+	// the port the replica listens on for clients, from REPLCONF listening-port
+	ListeningPort int
+	// false while the replica receives its snapshot, propagated writes are kept in buffer meanwhile
+	online bool
+	buffer []byte
 }
 
-func (replicateState *ReplicaState) NeedsAck() bool {
-	replicateState.Mu.Lock()
-	defer replicateState.Mu.Unlock()
-	return replicateState.LastAckOffset < replicateState.PendingOffset
+/** what INFO and ROLE report about a replica*/
+type ReplicaInfo struct {
+	IP    string
+	Port  int
+	State string
+	// the last offset the replica acknowledged
+	Offset int64
+	// seconds since its last ACK
+	Lag int64
 }
 
-func (replicaState *ReplicaState) SendAck(throttle time.Duration) error {
+func (replicaState *ReplicaState) info() ReplicaInfo {
 	replicaState.Mu.Lock()
 	defer replicaState.Mu.Unlock()
 
-	now := time.Now()
-	if now.Sub(replicaState.LastAckRequest) < throttle {
-		log.Printf("replica is throttled, skipping send GETACK")
-		return nil
+	ip, _, _ := net.SplitHostPort(replicaState.Addr)
+	info := ReplicaInfo{IP: ip, Port: replicaState.ListeningPort, State: "send_bulk", Offset: replicaState.LastAckOffset}
+	if replicaState.online {
+		info.State = "online"
+		info.Lag = int64(time.Since(replicaState.LastAckTime).Seconds())
 	}
-	replicaState.LastAckRequest = now
+	return info
+}
 
-	err := sendAckToReplica(replicaState.Conn)
-	if err != nil {
-		return err
+func replicasInfo() []ReplicaInfo {
+	var infos []ReplicaInfo
+	for _, replica := range GetAllConnectedReplicas() {
+		infos = append(infos, replica.info())
 	}
+	return infos
+}
 
-	return nil
+/** the number of online replicas that acknowledged at least the given offset*/
+func countReplicasAckedAt(offset int64) (acked, total int) {
+	for _, replica := range GetAllConnectedReplicas() {
+		replica.Mu.Lock()
+		online, ackOffset := replica.online, replica.LastAckOffset
+		replica.Mu.Unlock()
+		if !online {
+			continue
+		}
+		total++
+		if ackOffset >= offset {
+			acked++
+		}
+	}
+	return acked, total
+}
+
+/** the number of online replicas that acknowledged within maxLag, see min-replicas-max-lag*/
+func countGoodReplicas(maxLag time.Duration) int {
+	good := 0
+	for _, replica := range GetAllConnectedReplicas() {
+		replica.Mu.Lock()
+		if replica.online && time.Since(replica.LastAckTime) <= maxLag {
+			good++
+		}
+		replica.Mu.Unlock()
+	}
+	return good
+}
+
+/** ask every replica for its offset, through the replication stream so the offsets stay in step*/
+func requestReplicaAcks() {
+	broadcastToReplicas(RESPValue{Type: Array, Array: []RESPValue{
+		{Type: BulkString, String: CommandREPL},
+		{Type: BulkString, String: "GETACK"},
+		{Type: BulkString, String: "*"},
+	}})
+}
+
+var (
+	ackMu sync.Mutex
+	// closed and replaced whenever a replica acknowledges, waking every WAIT
+	ackReceived = make(chan struct{})
+)
+
+func ackNotification() <-chan struct{} {
+	ackMu.Lock()
+	defer ackMu.Unlock()
+	return ackReceived
+}
+
+func notifyAck() {
+	ackMu.Lock()
+	defer ackMu.Unlock()
+	close(ackReceived)
+	ackReceived = make(chan struct{})
 }
 
 func UpdateReplicaAckOffsetByConn(conn net.Conn, offset int64) {
@@ -142,7 +308,9 @@ func UpdateReplicaAckOffsetByConn(conn net.Conn, offset int64) {
 
 	rs := val.(*ReplicaState)
 	rs.Mu.Lock()
-	defer rs.Mu.Unlock()
 	rs.LastAckOffset = offset
+	rs.LastAckTime = time.Now()
+	rs.Mu.Unlock()
 	log.Printf("Replica [%v] updated ACK offset to %d", conn.RemoteAddr(), offset)
+	notifyAck()
 }
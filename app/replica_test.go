@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropTimedOutReplicas(t *testing.T) {
+	quiet, _ := net.Pipe()
+	acking, _ := net.Pipe()
+	syncing, _ := net.Pipe()
+	defer disconnectReplicas()
+
+	for _, conn := range []net.Conn{quiet, acking} {
+		assert.NoError(t, registerReplica(conn, 6380, 0).goOnline())
+	}
+	registerReplica(syncing, 6380, 0)
+
+	later := time.Now().Add(time.Minute)
+	UpdateReplicaAckOffsetByConn(acking, 0)
+	acked, _ := connectedReplicas.Load(acking)
+	acked.(*ReplicaState).LastAckTime = later
+
+	dropTimedOutReplicas(later.Add(time.Second), 30*time.Second)
+
+	_, ok := connectedReplicas.Load(quiet)
+	assert.False(t, ok)
+	_, ok = connectedReplicas.Load(acking)
+	assert.True(t, ok)
+	// a replica still loading its snapshot cannot ACK yet
+	_, ok = connectedReplicas.Load(syncing)
+	assert.True(t, ok)
+}
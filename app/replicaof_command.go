@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+/** REPLICAOF host port | REPLICAOF NO ONE, also known as SLAVEOF*/
+type ReplicaOfCommand struct {
+	values []RESPValue
+}
+
+func (r *ReplicaOfCommand) Name() string      { return CommandREPLICAOF }
+func (r *ReplicaOfCommand) Args() []RESPValue { return r.values[1:] }
+func (r *ReplicaOfCommand) Execute(ctx CommandContext) RESPValue {
+	args := r.Args()
+	if len(args) != 2 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'replicaof' command"}
+	}
+
+	host, port := args[0].String, args[1].String
+	if strings.EqualFold(host, "no") && strings.EqualFold(port, "one") {
+		becomeMaster()
+		return RESPValue{Type: SimpleString, String: "OK"}
+	}
+
+	if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+		return RESPValue{Type: Error, String: "ERR Invalid master port"}
+	}
+	if !becomeReplicaOf(host, port) {
+		return RESPValue{Type: SimpleString, String: "OK Already connected to specified master"}
+	}
+	return RESPValue{Type: SimpleString, String: "OK"}
+}
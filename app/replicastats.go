@@ -9,3 +9,8 @@ type ReplicaTrackingBytes struct {
 func (r *ReplicaTrackingBytes) writeBytes(n int) {
 	atomic.AddUint64(&r.BytesRead, uint64(n))
 }
+
+/** the replication offset of the last command fully processed*/
+func (r *ReplicaTrackingBytes) processedOffset() uint64 {
+	return atomic.LoadUint64(&r.BytesRead)
+}
@@ -3,43 +3,118 @@ package main
 import (
 	"bytes"
 	"log"
+	"strings"
 	"sync"
 	"text/template"
+	"time"
 )
 
-var (
-	role     string = "master"
-	initRole sync.Once
-)
-
+/** a server is a replica while it follows a master, at startup (--replicaof) or after REPLICAOF*/
 func getRole() string {
-	initRole.Do(func() {
-		val, exists := GetFlagValue(FlagReplicaof)
-		if exists {
-			log.Println("in replica: ", val)
-			role = "slave"
-		}
-	})
-
-	return role
+	if currentMasterLink() != nil {
+		return "slave"
+	}
+	return "master"
 }
 
 const replicationTemplate = `# Replication
 role:{{.Role}}
+{{- with .Link}}
+master_host:{{.Host}}
+master_port:{{.Port}}
+master_link_status:{{.Status}}
+slave_read_repl_offset:{{$.MasterReplOffset}}
+slave_repl_offset:{{$.MasterReplOffset}}
+{{- if ne .Status "up"}}
+master_link_down_since_seconds:{{.DownSinceSeconds}}
+{{- end}}
+slave_read_only:{{.ReadOnly}}
+{{- end}}
+connected_slaves:{{len .Replicas}}
+{{- range $i, $replica := .Replicas}}
+slave{{$i}}:ip={{.IP}},port={{.Port}},state={{.State}},offset={{.Offset}},lag={{.Lag}}
+{{- end}}
 master_replid:{{.MasterReplid}}
-master_repl_offset:{{.MasterReplOffset}}`
+master_replid2:{{.MasterReplid2}}
+master_repl_offset:{{.MasterReplOffset}}
+second_repl_offset:{{.SecondReplOffset}}
+repl_backlog_active:{{.Backlog.Active}}
+repl_backlog_size:{{.Backlog.Size}}
+repl_backlog_first_byte_offset:{{.Backlog.FirstByteOffset}}
+repl_backlog_histlen:{{.Backlog.Histlen}}`
 
 type ReplicationData struct {
 	Role             string
 	MasterReplid     string
+	MasterReplid2    string
 	MasterReplOffset int64
+	SecondReplOffset int64
+	Link             *MasterLinkData
+	Replicas         []ReplicaInfo
+	Backlog          BacklogInfo
+}
+
+/** the replica side fields, only shown while following a master*/
+type MasterLinkData struct {
+	Host, Port string
+	Status     string
+	// -1 if the link never was up
+	DownSinceSeconds int64
+	ReadOnly         int
+}
+
+type BacklogInfo struct {
+	Active          int
+	Size            int
+	FirstByteOffset int64
+	Histlen         int
+}
+
+func backlogInfo() BacklogInfo {
+	replicationMu.Lock()
+	defer replicationMu.Unlock()
+
+	if replBacklog == nil {
+		return BacklogInfo{Size: replBacklogSize()}
+	}
+	return BacklogInfo{
+		Active:          1,
+		Size:            len(replBacklog.buf),
+		FirstByteOffset: replBacklog.firstOffset(),
+		Histlen:         replBacklog.histlen,
+	}
+}
+
+func masterLinkInfo() *MasterLinkData {
+	link := currentMasterLink()
+	if link == nil {
+		return nil
+	}
+
+	data := &MasterLinkData{Host: link.masterHost, Port: link.masterPort, Status: "down", DownSinceSeconds: -1}
+	if getBoolConfig(ConfigReplicaReadOnly) {
+		data.ReadOnly = 1
+	}
+	up, downSince := link.Status()
+	if up {
+		data.Status = "up"
+	} else if !downSince.IsZero() {
+		data.DownSinceSeconds = int64(time.Since(downSince).Seconds())
+	}
+	return data
 }
 
 func replicationInfo() string {
+	replid2, secondOffset := GetMasterReplId2()
 	data := ReplicationData{
 		Role:             getRole(),
 		MasterReplid:     GetMasterReplId(),
-		MasterReplOffset: GetMasterReplOffset()}
+		MasterReplid2:    replid2,
+		MasterReplOffset: GetMasterReplOffset(),
+		SecondReplOffset: secondOffset,
+		Link:             masterLinkInfo(),
+		Replicas:         replicasInfo(),
+		Backlog:          backlogInfo()}
 
 	tmpl, err := template.New(InfoSectionReplication).Parse(replicationTemplate)
 	if err != nil {
@@ -54,10 +129,66 @@ func replicationInfo() string {
 	return buf.String()
 }
 
+const replIdLength = 40
+
+var (
+	replIdsMu sync.RWMutex
+	// the id of our replication history, random per run unless adopted from the master we follow
+	masterReplId = newReplId()
+	// the id of the history we continued, valid up to secondReplOffset (PSYNC2)
+	masterReplId2          = strings.Repeat("0", replIdLength)
+	secondReplOffset int64 = -1
+)
+
+func newReplId() string {
+	id, err := randomHex(replIdLength)
+	if err != nil {
+		panic(err)
+	}
+	return id
+}
+
 func GetMasterReplId() string {
-	return "8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb"
+	replIdsMu.RLock()
+	defer replIdsMu.RUnlock()
+	return masterReplId
+}
+
+func GetMasterReplId2() (string, int64) {
+	replIdsMu.RLock()
+	defer replIdsMu.RUnlock()
+	return masterReplId2, secondReplOffset
+}
+
+/** adopt the id of a new history (full resync), forgetting the previous one*/
+func setReplicationId(id string) {
+	replIdsMu.Lock()
+	defer replIdsMu.Unlock()
+	masterReplId = id
+	masterReplId2 = strings.Repeat("0", replIdLength)
+	secondReplOffset = -1
+}
+
+/**
+ * continue the current history under a new id: on promotion, or when our master was promoted.
+ * replicas still asking for the old id up to the current offset can partially resync
+ */
+func shiftReplicationId(id string) {
+	replIdsMu.Lock()
+	defer replIdsMu.Unlock()
+	masterReplId2 = masterReplId
+	secondReplOffset = masterReplOffset.Load() + 1
+	masterReplId = id
+	log.Printf("replication id switched to %s, previous id %s valid up to offset %d", masterReplId, masterReplId2, secondReplOffset)
+}
+
+/** whether a PSYNC for replID at psyncOffset refers to our history*/
+func canContinueHistory(replID string, psyncOffset int64) bool {
+	replIdsMu.RLock()
+	defer replIdsMu.RUnlock()
+	return replID == masterReplId || (replID == masterReplId2 && psyncOffset <= secondReplOffset)
 }
 
 func GetMasterReplOffset() int64 {
-	return 0
+	return masterReplOffset.Load()
 }
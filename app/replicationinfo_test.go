@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationInfo_Master(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+
+	conn, peer := net.Pipe()
+	defer unregisterReplica(conn)
+	go io.Copy(io.Discard, peer)
+	replicationMu.Lock()
+	ensureReplicationBacklog()
+	replica := registerReplica(conn, 6380, 0)
+	replicationMu.Unlock()
+	replica.Addr = "127.0.0.1:51234"
+	assert.NoError(t, replica.goOnline())
+	offset := broadcastToReplicas(RESPValue{Type: Array, Array: bulkArgs("PING")})
+	UpdateReplicaAckOffsetByConn(conn, offset)
+
+	lines := strings.Split(replicationInfo(), "\n")
+	assert.Contains(t, lines, "role:master")
+	assert.Contains(t, lines, "connected_slaves:1")
+	assert.Contains(t, lines, fmt.Sprintf("slave0:ip=127.0.0.1,port=6380,state=online,offset=%d,lag=0", offset))
+	assert.Contains(t, lines, "repl_backlog_active:1")
+	assert.Contains(t, lines, "repl_backlog_first_byte_offset:1")
+	assert.Contains(t, lines, fmt.Sprintf("repl_backlog_histlen:%d", offset))
+	assert.NotContains(t, lines, "master_link_status:up")
+}
+
+func TestRoleCommand(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+	role := func() []RESPValue {
+		return NewRoleCommand(bulkArgs("ROLE")).Execute(CommandContext{}).Array
+	}
+
+	conn, peer := net.Pipe()
+	defer unregisterReplica(conn)
+	go io.Copy(io.Discard, peer)
+	replicationMu.Lock()
+	ensureReplicationBacklog()
+	replica := registerReplica(conn, 6380, 0)
+	replicationMu.Unlock()
+	replica.Addr = "127.0.0.1:51234"
+
+	// still loading its snapshot
+	assert.Equal(t, []RESPValue{
+		{Type: BulkString, String: "master"},
+		{Type: Integer, Integer: 0},
+		{Type: Array, Array: []RESPValue{}},
+	}, role())
+
+	assert.NoError(t, replica.goOnline())
+	UpdateReplicaAckOffsetByConn(conn, 0)
+	assert.Equal(t, bulkArgs("127.0.0.1", "6380", "0"), role()[2].Array[0].Array)
+
+	masterLinkMu.Lock()
+	masterLink = &replicationLink{masterHost: "10.0.0.1", masterPort: "6379"}
+	masterLinkMu.Unlock()
+	defer func() {
+		masterLinkMu.Lock()
+		masterLink = nil
+		masterLinkMu.Unlock()
+	}()
+	assert.Equal(t, []RESPValue{
+		{Type: BulkString, String: "slave"},
+		{Type: BulkString, String: "10.0.0.1"},
+		{Type: Integer, Integer: 6379},
+		{Type: BulkString, String: "connect"},
+		{Type: Integer, Integer: 0},
+	}, role())
+}
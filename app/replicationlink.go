@@ -0,0 +1,230 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+	replicaAckPeriod  = time.Second
+)
+
+/**
+ * the replica side of replication: keeps a link to the master, reconnecting with exponential backoff
+ * whenever it drops. every reconnect tries to continue from the cached replid/offset (PSYNC)
+ */
+type replicationLink struct {
+	masterHost, masterPort, localPort string
+
+	mu   sync.Mutex
+	conn net.Conn
+	up   bool
+	// when the link went down, zero if it never was up
+	downSince time.Time
+	stopped   bool
+	stop      chan struct{}
+}
+
+func startReplicationLink(masterHost, masterPort, localPort string) *replicationLink {
+	link := &replicationLink{
+		masterHost: masterHost,
+		masterPort: masterPort,
+		localPort:  localPort,
+		stop:       make(chan struct{}),
+	}
+	go link.run()
+	return link
+}
+
+func (link *replicationLink) run() {
+	delay := minReconnectDelay
+	for {
+		conn, err := conntectToMaster(link.masterHost, link.masterPort)
+		if err == nil {
+			conn = timeoutConn{conn}
+		}
+		if err == nil && link.setConn(conn) {
+			if link.sync(conn) {
+				delay = minReconnectDelay
+			}
+		} else if err != nil {
+			log.Printf("[REPLICA] unable to connect with master: %v", err)
+		}
+
+		select {
+		case <-link.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+/** handshake and then apply the replication stream until the link drops. reports whether the link was up*/
+func (link *replicationLink) sync(conn net.Conn) bool {
+	defer link.setDown()
+
+	reader := NewTrackingBufReader(conn)
+	stats, err := performReplicationHandshake(conn, link.localPort, reader.Reader)
+	if err != nil {
+		log.Printf("[REPLICA] replication handshake with master failed: %v", err)
+		conn.Close()
+		return false
+	}
+
+	link.mu.Lock()
+	link.up = true
+	link.mu.Unlock()
+
+	log.Println("[REPLICA] link with master is up")
+	done := make(chan struct{})
+	go sendAckHeartbeats(conn, stats, done)
+	initiateCommandExecutionLoop(conn, reader, stats)
+	close(done)
+	log.Println("[REPLICA] link with master is down")
+	return true
+}
+
+/** REPLCONF ACK <offset> every second, so the master knows how far we got and that we are alive*/
+func sendAckHeartbeats(conn net.Conn, stats *ReplicaTrackingBytes, done <-chan struct{}) {
+	ticker := time.NewTicker(replicaAckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ack := RESPValue{Type: Array, Array: []RESPValue{
+				{Type: BulkString, String: CommandREPL},
+				{Type: BulkString, String: "ACK"},
+				{Type: BulkString, String: strconv.FormatUint(stats.processedOffset(), 10)},
+			}}
+			if err := writeSerializedDataToConnection(conn, ack); err != nil {
+				return
+			}
+		}
+	}
+}
+
+/**
+ * a master connection whose reads fail once the master stayed silent for repl-timeout. it pings
+ * every repl-ping-replica-period, so a silent master is a dead or partitioned one
+ */
+type timeoutConn struct {
+	net.Conn
+}
+
+func (c timeoutConn) Read(p []byte) (int, error) {
+	timeout := time.Duration(getIntConfig(ConfigReplTimeout)) * time.Second
+	c.Conn.SetReadDeadline(time.Now().Add(timeout))
+	return c.Conn.Read(p)
+}
+
+/** remember the connection so Stop can close it. false if the link was stopped meanwhile*/
+func (link *replicationLink) setConn(conn net.Conn) bool {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.stopped {
+		conn.Close()
+		return false
+	}
+	link.conn = conn
+	return true
+}
+
+func (link *replicationLink) setDown() {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.up {
+		link.downSince = time.Now()
+	}
+	link.up = false
+	link.conn = nil
+}
+
+/** close the link for good, it is not reconnected*/
+func (link *replicationLink) Stop() {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.stopped {
+		return
+	}
+	link.stopped = true
+	close(link.stop)
+	if link.conn != nil {
+		link.conn.Close()
+	}
+}
+
+/** whether the link is up, and if not since when it is down (zero if it never was up)*/
+func (link *replicationLink) Status() (up bool, downSince time.Time) {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	return link.up, link.downSince
+}
+
+/** the link state ROLE reports: connect while (re)connecting, sync during the handshake, connected once up*/
+func (link *replicationLink) State() string {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	switch {
+	case link.up:
+		return "connected"
+	case link.conn != nil:
+		return "sync"
+	}
+	return "connect"
+}
+
+var (
+	masterLinkMu sync.Mutex
+	// the link to our master, nil while we are a master
+	masterLink *replicationLink
+)
+
+func currentMasterLink() *replicationLink {
+	masterLinkMu.Lock()
+	defer masterLinkMu.Unlock()
+	return masterLink
+}
+
+/** follow the master at host:port instead of the current one. false if it is already followed*/
+func becomeReplicaOf(host, port string) bool {
+	masterLinkMu.Lock()
+	defer masterLinkMu.Unlock()
+
+	if masterLink != nil {
+		if masterLink.masterHost == host && masterLink.masterPort == port {
+			return false
+		}
+		masterLink.Stop()
+	}
+	// our own replicas have to follow the history we are about to switch to
+	disconnectReplicas()
+	masterLink = startReplicationLink(host, port, resolvePort())
+	log.Printf("following master %s:%s", host, port)
+	return true
+}
+
+/** stop following the master and keep the dataset. the history continues under a new replication id*/
+func becomeMaster() {
+	masterLinkMu.Lock()
+	defer masterLinkMu.Unlock()
+
+	if masterLink == nil {
+		return
+	}
+	masterLink.Stop()
+	masterLink = nil
+
+	shiftReplicationId(newReplId())
+	// they reconnect, and continue partially thanks to the secondary id
+	disconnectReplicas()
+	log.Println("promoted to master")
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/** a master that answers the handshake and hands every PSYNC's arguments to psync, which writes the reply*/
+func fakeMaster(listener net.Listener, psync func(conn net.Conn, args []RESPValue)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		reader := NewTrackingBufReader(conn)
+		for {
+			val, err := parseRESPValue(reader)
+			if err != nil {
+				break
+			}
+			switch val.Array[0].String {
+			case "PING":
+				conn.Write([]byte("+PONG\r\n"))
+			case "REPLCONF":
+				conn.Write([]byte("+OK\r\n"))
+			case "PSYNC":
+				psync(conn, val.Array[1:])
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestReplicationLink_ReconnectsAndContinues(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+	ownID := GetMasterReplId()
+	defer setReplicationId(ownID)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	masterID := newReplId()
+	set, _ := RESPValue{Type: Array, Array: bulkArgs("SET", "k", "v")}.Serialize()
+	psyncs := make(chan []string, 2)
+	go fakeMaster(listener, func(conn net.Conn, args []RESPValue) {
+		psyncs <- []string{args[0].String, args[1].String}
+		if args[0].String == "?" {
+			rdb := generateEmptyRDB()
+			fmt.Fprintf(conn, "+FULLRESYNC %s 100\r\n$%d\r\n%s", masterID, len(rdb), rdb)
+			conn.Write(set)
+			// drop the link once the write was sent
+			time.Sleep(50 * time.Millisecond)
+			conn.Close()
+			return
+		}
+		conn.Write([]byte("+CONTINUE\r\n"))
+	})
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	link := startReplicationLink(host, port, "6380")
+	defer link.Stop()
+
+	assert.Equal(t, []string{"?", "-1"}, <-psyncs)
+	select {
+	case args := <-psyncs:
+		assert.Equal(t, []string{masterID, fmt.Sprint(100 + len(set) + 1)}, args)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the replica did not reconnect")
+	}
+	assert.Equal(t, masterID, GetMasterReplId())
+}
+
+func TestReplicationLink_DownWhileMasterUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	link := startReplicationLink(host, port, "6380")
+	defer link.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	up, downSince := link.Status()
+	assert.False(t, up)
+	assert.True(t, downSince.IsZero())
+}
+
+func TestReplicaOf_SwitchesRole(t *testing.T) {
+	defer resetReplication()
+	resetReplication()
+	ownID := GetMasterReplId()
+	defer setReplicationId(ownID)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	masterID := newReplId()
+	synced := make(chan struct{}, 1)
+	go fakeMaster(listener, func(conn net.Conn, args []RESPValue) {
+		rdb := generateEmptyRDB()
+		fmt.Fprintf(conn, "+FULLRESYNC %s 0\r\n$%d\r\n%s", masterID, len(rdb), rdb)
+		synced <- struct{}{}
+	})
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+
+	replicaOf := func(args ...string) RESPValue {
+		return NewReplicaOfCommand(bulkArgs(append([]string{"REPLICAOF"}, args...)...)).Execute(CommandContext{})
+	}
+
+	assert.Equal(t, "OK", replicaOf(host, port).String)
+	assert.Equal(t, "slave", getRole())
+	assert.Equal(t, "OK Already connected to specified master", replicaOf(host, port).String)
+	<-synced
+	assert.Eventually(t, func() bool { return GetMasterReplId() == masterID }, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, "OK", replicaOf("no", "one").String)
+	assert.Equal(t, "master", getRole())
+	replid2, _ := GetMasterReplId2()
+	assert.Equal(t, masterID, replid2)
+	assert.NotEqual(t, masterID, GetMasterReplId())
+
+	assert.Equal(t, Error, replicaOf(host, "not-a-port").Type)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strconv"
+)
+
+/**
+ * ROLE, the topology as clients discover it. a master replies master, its offset and [ip, port, offset]
+ * per online replica; a replica replies slave, the master host and port, the link state and its offset
+ */
+type RoleCommand struct {
+	values []RESPValue
+}
+
+func (r *RoleCommand) Name() string      { return CommandROLE }
+func (r *RoleCommand) Args() []RESPValue { return r.values[1:] }
+func (r *RoleCommand) Execute(ctx CommandContext) RESPValue {
+	if len(r.Args()) != 0 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'role' command"}
+	}
+
+	if link := currentMasterLink(); link != nil {
+		port, _ := strconv.ParseInt(link.masterPort, 10, 64)
+		return RESPValue{Type: Array, Array: []RESPValue{
+			{Type: BulkString, String: "slave"},
+			{Type: BulkString, String: link.masterHost},
+			{Type: Integer, Integer: port},
+			{Type: BulkString, String: link.State()},
+			{Type: Integer, Integer: GetMasterReplOffset()},
+		}}
+	}
+
+	replicas := []RESPValue{}
+	for _, replica := range replicasInfo() {
+		if replica.State != "online" {
+			continue
+		}
+		replicas = append(replicas, RESPValue{Type: Array, Array: []RESPValue{
+			{Type: BulkString, String: replica.IP},
+			{Type: BulkString, String: strconv.Itoa(replica.Port)},
+			{Type: BulkString, String: strconv.FormatInt(replica.Offset, 10)},
+		}})
+	}
+	return RESPValue{Type: Array, Array: []RESPValue{
+		{Type: BulkString, String: "master"},
+		{Type: Integer, Integer: GetMasterReplOffset()},
+		{Type: Array, Array: replicas},
+	}}
+}
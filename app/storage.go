@@ -3,6 +3,8 @@ package main
 import (
 	"sync"
 	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
 )
 
 type LookupStatus int
@@ -19,6 +21,10 @@ type Store interface {
 	Get(key string, expectedType EntryType) (Entry, LookupStatus)
 	Keys() []string
 	Delete(key string) bool
+	CompareAndDelete(key string, value any) bool
+	LoadOrStore(key string, value Entry) (actual Entry, loaded bool)
+	Snapshot() map[string]Entry
+	Flush()
 }
 
 var store Store
@@ -43,6 +49,9 @@ func (store *inMemoryStore) Set(key string, value Entry) {
 	defer store.mutex.Unlock()
 	if !value.IsExpired() {
 		store.data[key] = value
+	} else {
+		// setting an already expired value removes the key
+		delete(store.data, key)
 	}
 }
 
@@ -82,6 +91,59 @@ func (store *inMemoryStore) Delete(key string) bool {
 	return false
 }
 
+/** delete key only while it still holds value, which must be comparable (e.g. a pointer)*/
+func (store *inMemoryStore) CompareAndDelete(key string, value any) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if entry, exists := store.data[key]; exists && entry.Val == value {
+		delete(store.data, key)
+		return true
+	}
+	return false
+}
+
+/** return the live entry stored under key, or store value if there is none. loaded reports whether an existing entry was returned*/
+func (store *inMemoryStore) LoadOrStore(key string, value Entry) (Entry, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if existing, ok := store.data[key]; ok && !existing.IsExpired() {
+		return existing, true
+	}
+
+	store.data[key] = value
+	return value, false
+}
+
+/**
+ * a point in time copy of all live entries. streams are modified in place, so they are cloned,
+ * other values are replaced on every write and can be shared
+ */
+func (store *inMemoryStore) Snapshot() map[string]Entry {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	snapshot := make(map[string]Entry, len(store.data))
+	for key, entry := range store.data {
+		if entry.IsExpired() {
+			continue
+		}
+		if s, ok := entry.Val.(*stream.Stream); ok {
+			entry.Val = s.Clone()
+		}
+		snapshot[key] = entry
+	}
+	return snapshot
+}
+
+/** drop every key, e.g. before a replica loads the snapshot of a full resync*/
+func (store *inMemoryStore) Flush() {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.data = make(map[string]Entry)
+}
+
 func (store *inMemoryStore) Keys() []string {
 	store.mutex.RLock()
 	defer store.mutex.RUnlock()
@@ -99,6 +161,10 @@ func (store *inMemoryStore) Keys() []string {
 	return keys
 }
 
+/**
+ * Val holds a string, *stream.Stream, []string (list), map[string]struct{} (set),
+ * map[string]string (hash) or map[string]float64 (sorted set) depending on Type
+ */
 type Entry struct {
 	Val      any
 	ExpireAt *int64
@@ -110,6 +176,10 @@ type EntryType string
 const (
 	StreamEntryType  EntryType = "stream"
 	StringEntryType  EntryType = "string"
+	ListEntryType    EntryType = "list"
+	SetEntryType     EntryType = "set"
+	HashEntryType    EntryType = "hash"
+	ZSetEntryType    EntryType = "zset"
 	AnyEntryType     EntryType = "any"
 	MissingEntryType EntryType = "none"
 )
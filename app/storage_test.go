@@ -1,5 +1,12 @@
 package main
 
+import (
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+	"github.com/stretchr/testify/assert"
+)
+
 func ResetStore() {
 	if s, ok := store.(*inMemoryStore); ok {
 		s.mutex.Lock()
@@ -7,3 +14,31 @@ func ResetStore() {
 		s.data = make(map[string]Entry)
 	}
 }
+
+func TestSnapshot_ClonesStreams(t *testing.T) {
+	ResetStore()
+	xAdd("s", "1-0", "f", "v")
+
+	snapshot := store.Snapshot()
+	xAdd("s", "2-0", "f", "v")
+
+	assert.Equal(t, 1, snapshot["s"].Val.(*stream.Stream).Len())
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	ResetStore()
+	created := stream.NewStream()
+	store.Set("s", Entry{Val: created, Type: StreamEntryType})
+
+	// the key was replaced meanwhile, the new value stays
+	store.Set("s", Entry{Val: stream.NewStream(), Type: StreamEntryType})
+	assert.False(t, store.CompareAndDelete("s", created))
+	_, status := store.Get("s", StreamEntryType)
+	assert.Equal(t, Found, status)
+
+	store.Set("s", Entry{Val: created, Type: StreamEntryType})
+	assert.True(t, store.CompareAndDelete("s", created))
+	_, status = store.Get("s", StreamEntryType)
+	assert.Equal(t, NotFound, status)
+	assert.False(t, store.CompareAndDelete("missing", created))
+}
@@ -0,0 +1,623 @@
+package stream
+
+import (
+	"errors"
+	"sort"
+
+	art "github.com/plar/go-adaptive-radix-tree"
+)
+
+// InvalidEntriesRead marks a group read counter that is unknown and has to be estimated.
+const InvalidEntriesRead int64 = -1
+
+var (
+	ErrNoGroup        = errors.New("NOGROUP No such consumer group")
+	ErrBusyGroup      = errors.New("BUSYGROUP Consumer Group name already exists")
+	ErrNoConsumerName = errors.New("ERR consumer name must not be empty")
+)
+
+// ConsumerGroup tracks the delivery state of a group of consumers reading the same stream.
+type ConsumerGroup struct {
+	Name            string
+	LastDeliveredID StreamID
+	// logical number of entries the group has read, InvalidEntriesRead when unknown
+	EntriesRead int64
+	// pending entries list of the whole group, keyed like the stream itself
+	pending   art.Tree
+	consumers map[string]*Consumer
+}
+
+// Consumer is a single member of a consumer group with its own pending entries.
+type Consumer struct {
+	Name string
+	// last time the consumer interacted with the group, in unix ms
+	SeenTime int64
+	// last time the consumer read or claimed an entry, in unix ms. -1 if it never did
+	ActiveTime int64
+	pending    art.Tree
+}
+
+// PendingEntry is an entry that was delivered to a consumer but not acknowledged yet.
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  int64
+	DeliveryCount int64
+}
+
+// PendingSummary is the XPENDING reply without a range.
+type PendingSummary struct {
+	Count     int
+	MinID     StreamID
+	MaxID     StreamID
+	Consumers []ConsumerPendingCount
+}
+
+type ConsumerPendingCount struct {
+	Name  string
+	Count int
+}
+
+// PendingFilter restricts the pending entries returned by PendingRange.
+type PendingFilter struct {
+	Start, End StreamID
+	Count      int
+	Consumer   string
+	MinIdle    int64
+}
+
+// ClaimOptions are the XCLAIM modifiers.
+type ClaimOptions struct {
+	// Idle and Time set the delivery time of the claimed entries. nil keeps "now"
+	Idle       *int64
+	Time       *int64
+	RetryCount *int64
+	Force      bool
+	JustID     bool
+	LastID     *StreamID
+}
+
+func newConsumerGroup(name string, lastDelivered StreamID, entriesRead int64) *ConsumerGroup {
+	return &ConsumerGroup{
+		Name:            name,
+		LastDeliveredID: lastDelivered,
+		EntriesRead:     entriesRead,
+		pending:         art.New(),
+		consumers:       make(map[string]*Consumer),
+	}
+}
+
+func newConsumer(name string, now int64) *Consumer {
+	return &Consumer{
+		Name:       name,
+		SeenTime:   now,
+		ActiveTime: -1,
+		pending:    art.New(),
+	}
+}
+
+/** deep copy of the group, its pending entries are copied and shared by the copied consumers like in the original*/
+func (group *ConsumerGroup) clone() *ConsumerGroup {
+	clone := newConsumerGroup(group.Name, group.LastDeliveredID, group.EntriesRead)
+	group.pending.ForEach(func(node art.Node) bool {
+		pendingEntry := *node.Value().(*PendingEntry)
+		clone.pending.Insert(node.Key(), &pendingEntry)
+		return true
+	})
+	for name, consumer := range group.consumers {
+		consumerClone := &Consumer{
+			Name:       consumer.Name,
+			SeenTime:   consumer.SeenTime,
+			ActiveTime: consumer.ActiveTime,
+			pending:    art.New(),
+		}
+		consumer.pending.ForEach(func(node art.Node) bool {
+			if pendingEntry, ok := clone.pending.Search(node.Key()); ok {
+				consumerClone.pending.Insert(node.Key(), pendingEntry)
+			}
+			return true
+		})
+		clone.consumers[name] = consumerClone
+	}
+	return clone
+}
+
+// CreateGroup adds a new consumer group that will deliver entries after lastDelivered.
+// entriesRead is the group's read counter, InvalidEntriesRead if unknown.
+func (s *Stream) CreateGroup(name string, lastDelivered StreamID, entriesRead int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.groups[name]; exists {
+		return ErrBusyGroup
+	}
+	s.groups[name] = newConsumerGroup(name, lastDelivered, entriesRead)
+	return nil
+}
+
+// DestroyGroup removes a consumer group with all its consumers and pending entries.
+func (s *Stream) DestroyGroup(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.groups[name]; !exists {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// SetGroupID sets the last delivered id and the read counter of a consumer group.
+func (s *Stream) SetGroupID(name string, lastDelivered StreamID, entriesRead int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[name]
+	if !ok {
+		return ErrNoGroup
+	}
+	group.LastDeliveredID = lastDelivered
+	group.EntriesRead = entriesRead
+	return nil
+}
+
+// HasGroup reports whether the stream has a consumer group with the given name.
+func (s *Stream) HasGroup(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.groups[name]
+	return ok
+}
+
+/**
+ * create a consumer in the group.
+ * @return created is false if the consumer already existed
+ */
+func (s *Stream) CreateConsumer(groupName, consumerName string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return false, ErrNoGroup
+	}
+	if consumerName == "" {
+		return false, ErrNoConsumerName
+	}
+	if _, exists := group.consumers[consumerName]; exists {
+		return false, nil
+	}
+	group.consumers[consumerName] = newConsumer(consumerName, currentTimeMillis())
+	return true, nil
+}
+
+/**
+ * delete a consumer from the group, its pending entries are dropped from the group as well.
+ * @return the number of pending entries the consumer had, and whether it existed
+ */
+func (s *Stream) DeleteConsumer(groupName, consumerName string) (int, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return 0, false, ErrNoGroup
+	}
+	consumer, ok := group.consumers[consumerName]
+	if !ok {
+		return 0, false, nil
+	}
+
+	pendingCount := consumer.pending.Size()
+	consumer.pending.ForEach(func(node art.Node) bool {
+		group.pending.Delete(node.Key())
+		return true
+	})
+	delete(group.consumers, consumerName)
+	return pendingCount, true, nil
+}
+
+/**
+ * read new entries for a consumer, the XREADGROUP ">" case. the entries are added to the
+ * consumer pending list unless noAck is set, and the group last delivered id is moved forward.
+ */
+func (s *Stream) ReadGroupNew(groupName, consumerName string, count int, noAck bool) ([]StreamEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, consumer, err := s.lookupConsumer(groupName, consumerName)
+	if err != nil {
+		return nil, err
+	}
+
+	start, ok := group.LastDeliveredID.Next()
+	if !ok {
+		return []StreamEntry{}, nil
+	}
+
+	now := currentTimeMillis()
+	var entries []StreamEntry
+	s.forEachInRange(start, MaxID, func(entry *StreamEntry) bool {
+		entries = append(entries, *entry)
+		s.advanceGroup(group, entry.ID)
+		if !noAck {
+			group.deliver(consumer, entry.ID, now)
+		}
+		return count <= 0 || len(entries) < count
+	})
+
+	if len(entries) > 0 {
+		consumer.ActiveTime = now
+	}
+	if entries == nil {
+		return []StreamEntry{}, nil
+	}
+	return entries, nil
+}
+
+/**
+ * read the consumer's own pending entries with id > after, the XREADGROUP history case.
+ * entries that were deleted from the stream are returned with nil Fields.
+ */
+func (s *Stream) ReadGroupPending(groupName, consumerName string, after StreamID, count int) ([]StreamEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, consumer, err := s.lookupConsumer(groupName, consumerName)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []StreamEntry{}
+	consumer.pending.ForEach(func(node art.Node) bool {
+		pendingEntry := node.Value().(*PendingEntry)
+		if !after.LessThan(pendingEntry.ID) {
+			return true
+		}
+		entries = append(entries, s.entryOrDeleted(pendingEntry.ID))
+		return count <= 0 || len(entries) < count
+	})
+
+	return entries, nil
+}
+
+/**
+ * acknowledge entries of a group, removing them from the pending lists.
+ * @return the number of entries that were actually pending
+ */
+func (s *Stream) Ack(groupName string, ids []StreamID) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return 0, ErrNoGroup
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if group.removePending(id) {
+			acked++
+		}
+	}
+	return acked, nil
+}
+
+// PendingSummary returns the summary form of XPENDING.
+func (s *Stream) PendingSummary(groupName string) (PendingSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return PendingSummary{}, ErrNoGroup
+	}
+
+	summary := PendingSummary{Count: group.pending.Size()}
+	if summary.Count == 0 {
+		return summary, nil
+	}
+
+	minEntry, _ := group.pending.Minimum()
+	maxEntry, _ := group.pending.Maximum()
+	summary.MinID = minEntry.(*PendingEntry).ID
+	summary.MaxID = maxEntry.(*PendingEntry).ID
+
+	counts := make(map[string]int)
+	group.pending.ForEach(func(node art.Node) bool {
+		counts[node.Value().(*PendingEntry).Consumer]++
+		return true
+	})
+	for _, name := range sortedKeys(counts) {
+		summary.Consumers = append(summary.Consumers, ConsumerPendingCount{Name: name, Count: counts[name]})
+	}
+	return summary, nil
+}
+
+// PendingRange returns the extended form of XPENDING.
+func (s *Stream) PendingRange(groupName string, filter PendingFilter) ([]PendingEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return nil, ErrNoGroup
+	}
+
+	pel := group.pending
+	if filter.Consumer != "" {
+		consumer, ok := group.consumers[filter.Consumer]
+		if !ok {
+			return []PendingEntry{}, nil
+		}
+		pel = consumer.pending
+	}
+
+	now := currentTimeMillis()
+	entries := []PendingEntry{}
+	if filter.Count <= 0 {
+		return entries, nil
+	}
+	pel.ForEach(func(node art.Node) bool {
+		pendingEntry := node.Value().(*PendingEntry)
+		if pendingEntry.ID.LessThan(filter.Start) {
+			return true
+		}
+		if filter.End.LessThan(pendingEntry.ID) {
+			return false
+		}
+		if now-pendingEntry.DeliveryTime < filter.MinIdle {
+			return true
+		}
+		entries = append(entries, *pendingEntry)
+		return len(entries) < filter.Count
+	})
+	return entries, nil
+}
+
+/**
+ * transfer ownership of pending entries idle for at least minIdle ms to consumer (XCLAIM).
+ * entries that no longer exist in the stream are dropped from the pending list.
+ * @return the claimed entries and the ids that were dropped from the pending list
+ */
+func (s *Stream) Claim(groupName, consumerName string, minIdle int64, ids []StreamID, opts ClaimOptions) ([]StreamEntry, []StreamID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, consumer, err := s.lookupConsumer(groupName, consumerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := currentTimeMillis()
+	deliveryTime := now
+	if opts.Idle != nil {
+		deliveryTime = now - *opts.Idle
+	} else if opts.Time != nil {
+		deliveryTime = *opts.Time
+	}
+	// like Redis, a delivery time in the future (or before the epoch) is taken as now
+	if deliveryTime < 0 || deliveryTime > now {
+		deliveryTime = now
+	}
+
+	if opts.LastID != nil && group.LastDeliveredID.LessThan(*opts.LastID) {
+		group.LastDeliveredID = *opts.LastID
+	}
+
+	claimed := []StreamEntry{}
+	deleted := []StreamID{}
+	for _, id := range ids {
+		entry, exists := s.tree.Search(encodeKey(id))
+		value, isPending := group.pending.Search(encodeKey(id))
+
+		if !exists {
+			// the entry was deleted from the stream, it can never be delivered again
+			if isPending {
+				group.removePending(id)
+				deleted = append(deleted, id)
+			}
+			continue
+		}
+
+		var pendingEntry *PendingEntry
+		if isPending {
+			pendingEntry = value.(*PendingEntry)
+			// a min idle time of 0 claims regardless of the delivery time, even one ahead of our clock
+			if minIdle > 0 && now-pendingEntry.DeliveryTime < minIdle {
+				continue
+			}
+		} else {
+			if !opts.Force {
+				continue
+			}
+			pendingEntry = group.deliver(consumer, id, deliveryTime)
+			pendingEntry.DeliveryCount = 0
+		}
+
+		group.transfer(pendingEntry, consumer)
+		pendingEntry.DeliveryTime = deliveryTime
+		if opts.RetryCount != nil {
+			pendingEntry.DeliveryCount = *opts.RetryCount
+		} else if !opts.JustID {
+			pendingEntry.DeliveryCount++
+		}
+
+		consumer.ActiveTime = now
+		claimed = append(claimed, *entry.(*StreamEntry))
+	}
+
+	return claimed, deleted, nil
+}
+
+/**
+ * scan the group pending list from start and claim entries idle for at least minIdle ms (XAUTOCLAIM).
+ * at most count entries are claimed or dropped as deleted, and at most count*10 pending entries are scanned.
+ * @return the cursor to continue from (0-0 when the scan is complete), the claimed entries
+ * and the ids of pending entries that were deleted from the stream
+ */
+func (s *Stream) AutoClaim(groupName, consumerName string, minIdle int64, start StreamID, count int, justID bool) (StreamID, []StreamEntry, []StreamID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, consumer, err := s.lookupConsumer(groupName, consumerName)
+	if err != nil {
+		return StreamID{}, nil, nil, err
+	}
+
+	now := currentTimeMillis()
+	attempts := count * 10
+	next := MinID
+	var toClaim []*PendingEntry
+	var deleted []StreamID
+
+	// the pending tree must not be modified while iterating it, so changes are applied afterwards
+	group.pending.ForEach(func(node art.Node) bool {
+		pendingEntry := node.Value().(*PendingEntry)
+		if pendingEntry.ID.LessThan(start) {
+			return true
+		}
+		// deleted entries count against count too, they are part of the reply
+		if attempts == 0 || len(toClaim)+len(deleted) >= count {
+			next = pendingEntry.ID
+			return false
+		}
+		attempts--
+
+		if _, exists := s.tree.Search(encodeKey(pendingEntry.ID)); !exists {
+			deleted = append(deleted, pendingEntry.ID)
+		} else if now-pendingEntry.DeliveryTime >= minIdle {
+			toClaim = append(toClaim, pendingEntry)
+		}
+		return true
+	})
+
+	for _, id := range deleted {
+		group.removePending(id)
+	}
+
+	claimed := []StreamEntry{}
+	for _, pendingEntry := range toClaim {
+		group.transfer(pendingEntry, consumer)
+		pendingEntry.DeliveryTime = now
+		if !justID {
+			pendingEntry.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+		claimed = append(claimed, s.entryOrDeleted(pendingEntry.ID))
+	}
+
+	if deleted == nil {
+		deleted = []StreamID{}
+	}
+	return next, claimed, deleted, nil
+}
+
+// GroupPosition returns the last delivered id and the read counter of a consumer group.
+func (s *Stream) GroupPosition(groupName string) (StreamID, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return StreamID{}, 0, ErrNoGroup
+	}
+	return group.LastDeliveredID, group.EntriesRead, nil
+}
+
+// Pending returns the pending entry of the group with the given id, if there is one.
+func (s *Stream) Pending(groupName string, id StreamID) (PendingEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return PendingEntry{}, false
+	}
+	value, ok := group.pending.Search(encodeKey(id))
+	if !ok {
+		return PendingEntry{}, false
+	}
+	return *value.(*PendingEntry), true
+}
+
+/** find the group and consumer, creating the consumer if needed. caller must hold s.mu*/
+func (s *Stream) lookupConsumer(groupName, consumerName string) (*ConsumerGroup, *Consumer, error) {
+	group, ok := s.groups[groupName]
+	if !ok {
+		return nil, nil, ErrNoGroup
+	}
+	if consumerName == "" {
+		return nil, nil, ErrNoConsumerName
+	}
+
+	now := currentTimeMillis()
+	consumer, ok := group.consumers[consumerName]
+	if !ok {
+		consumer = newConsumer(consumerName, now)
+		group.consumers[consumerName] = consumer
+	}
+	consumer.SeenTime = now
+	return group, consumer, nil
+}
+
+/** return the entry with the given id, or an entry with nil Fields if it was deleted. caller must hold s.mu*/
+func (s *Stream) entryOrDeleted(id StreamID) StreamEntry {
+	if value, ok := s.tree.Search(encodeKey(id)); ok {
+		return *value.(*StreamEntry)
+	}
+	return StreamEntry{ID: id}
+}
+
+/** add id to the pending lists as delivered to consumer now, or move it there if another consumer owned it*/
+func (group *ConsumerGroup) deliver(consumer *Consumer, id StreamID, now int64) *PendingEntry {
+	if value, ok := group.pending.Search(encodeKey(id)); ok {
+		pendingEntry := value.(*PendingEntry)
+		group.transfer(pendingEntry, consumer)
+		pendingEntry.DeliveryTime = now
+		pendingEntry.DeliveryCount++
+		return pendingEntry
+	}
+
+	pendingEntry := &PendingEntry{
+		ID:            id,
+		Consumer:      consumer.Name,
+		DeliveryTime:  now,
+		DeliveryCount: 1,
+	}
+	group.pending.Insert(encodeKey(id), pendingEntry)
+	consumer.pending.Insert(encodeKey(id), pendingEntry)
+	return pendingEntry
+}
+
+/** move a pending entry to a new owner*/
+func (group *ConsumerGroup) transfer(pendingEntry *PendingEntry, newOwner *Consumer) {
+	if pendingEntry.Consumer == newOwner.Name {
+		return
+	}
+	if previous, ok := group.consumers[pendingEntry.Consumer]; ok {
+		previous.pending.Delete(encodeKey(pendingEntry.ID))
+	}
+	pendingEntry.Consumer = newOwner.Name
+	newOwner.pending.Insert(encodeKey(pendingEntry.ID), pendingEntry)
+}
+
+func (group *ConsumerGroup) removePending(id StreamID) bool {
+	value, ok := group.pending.Delete(encodeKey(id))
+	if !ok {
+		return false
+	}
+	if consumer, exists := group.consumers[value.(*PendingEntry).Consumer]; exists {
+		consumer.pending.Delete(encodeKey(id))
+	}
+	return true
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
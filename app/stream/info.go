@@ -0,0 +1,243 @@
+package stream
+
+import (
+	"sort"
+
+	art "github.com/plar/go-adaptive-radix-tree"
+)
+
+// StreamInfo is a snapshot of a stream used by XINFO STREAM.
+type StreamInfo struct {
+	Length          int
+	RadixTreeKeys   int
+	RadixTreeNodes  int
+	LastGeneratedID StreamID
+	MaxDeletedID    StreamID
+	EntriesAdded    int64
+	GroupCount      int
+	RecordedFirstID StreamID
+	FirstEntry      *StreamEntry
+	LastEntry       *StreamEntry
+	// only set for the FULL form
+	Entries []StreamEntry
+	Groups  []GroupInfo
+}
+
+// GroupInfo describes a consumer group, as reported by XINFO GROUPS and XINFO STREAM FULL.
+type GroupInfo struct {
+	Name            string
+	LastDeliveredID StreamID
+	// InvalidEntriesRead when unknown
+	EntriesRead int64
+	Lag         int64
+	LagValid    bool
+	PelCount    int
+	// only set for the FULL form
+	Pending   []PendingEntry
+	Consumers []ConsumerInfo
+}
+
+// ConsumerInfo describes a consumer, as reported by XINFO CONSUMERS and XINFO STREAM FULL.
+type ConsumerInfo struct {
+	Name       string
+	SeenTime   int64
+	ActiveTime int64
+	PelCount   int
+	// only set for the FULL form
+	Pending []PendingEntry
+}
+
+/**
+ * return a snapshot of the stream. when full is set the entries, groups, consumers and
+ * pending lists are included, each limited to count items (count <= 0 means no limit).
+ */
+func (s *Stream) Info(full bool, count int) StreamInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info := StreamInfo{
+		Length:          s.tree.Size(),
+		RadixTreeKeys:   (s.tree.Size() + NodeMaxEntries - 1) / NodeMaxEntries,
+		LastGeneratedID: s.lastID,
+		MaxDeletedID:    s.maxDeletedID,
+		EntriesAdded:    s.entriesAdded,
+		GroupCount:      len(s.groups),
+	}
+	s.tree.ForEach(func(node art.Node) bool {
+		info.RadixTreeNodes++
+		return true
+	}, art.TraverseNode)
+
+	if first, ok := s.tree.Minimum(); ok {
+		info.FirstEntry = first.(*StreamEntry)
+		info.RecordedFirstID = info.FirstEntry.ID
+	}
+	if last, ok := s.tree.Maximum(); ok {
+		info.LastEntry = last.(*StreamEntry)
+	}
+
+	if !full {
+		return info
+	}
+
+	info.Entries = []StreamEntry{}
+	s.tree.ForEach(func(node art.Node) bool {
+		info.Entries = append(info.Entries, *node.Value().(*StreamEntry))
+		return count <= 0 || len(info.Entries) < count
+	})
+	info.Groups = s.groupsInfo(true, count)
+	return info
+}
+
+// GroupsInfo describes all the consumer groups of the stream, ordered by name.
+func (s *Stream) GroupsInfo() []GroupInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.groupsInfo(false, 0)
+}
+
+// ConsumersInfo describes the consumers of a group, ordered by name.
+func (s *Stream) ConsumersInfo(groupName string) ([]ConsumerInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupName]
+	if !ok {
+		return nil, ErrNoGroup
+	}
+	return group.consumersInfo(false, 0), nil
+}
+
+/** caller must hold s.mu*/
+func (s *Stream) groupsInfo(full bool, count int) []GroupInfo {
+	names := make([]string, 0, len(s.groups))
+	for name := range s.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	groups := make([]GroupInfo, 0, len(names))
+	for _, name := range names {
+		group := s.groups[name]
+		lag, lagValid := s.groupLag(group)
+		info := GroupInfo{
+			Name:            group.Name,
+			LastDeliveredID: group.LastDeliveredID,
+			EntriesRead:     group.EntriesRead,
+			Lag:             lag,
+			LagValid:        lagValid,
+			PelCount:        group.pending.Size(),
+			Consumers:       group.consumersInfo(full, count),
+		}
+		if full {
+			info.Pending = pendingEntries(group.pending, count)
+		}
+		groups = append(groups, info)
+	}
+	return groups
+}
+
+func (group *ConsumerGroup) consumersInfo(full bool, count int) []ConsumerInfo {
+	names := make([]string, 0, len(group.consumers))
+	for name := range group.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	consumers := make([]ConsumerInfo, 0, len(names))
+	for _, name := range names {
+		consumer := group.consumers[name]
+		info := ConsumerInfo{
+			Name:       consumer.Name,
+			SeenTime:   consumer.SeenTime,
+			ActiveTime: consumer.ActiveTime,
+			PelCount:   consumer.pending.Size(),
+		}
+		if full {
+			info.Pending = pendingEntries(consumer.pending, count)
+		}
+		consumers = append(consumers, info)
+	}
+	return consumers
+}
+
+func pendingEntries(pel art.Tree, count int) []PendingEntry {
+	entries := []PendingEntry{}
+	pel.ForEach(func(node art.Node) bool {
+		entries = append(entries, *node.Value().(*PendingEntry))
+		return count <= 0 || len(entries) < count
+	})
+	return entries
+}
+
+/**
+ * move the group last delivered id to id and keep its read counter up to date.
+ * the counter can only be incremented when no deleted entries lie ahead. caller must hold s.mu
+ */
+func (s *Stream) advanceGroup(group *ConsumerGroup, id StreamID) {
+	if !group.LastDeliveredID.LessThan(id) {
+		return
+	}
+	if group.EntriesRead != InvalidEntriesRead && !s.hasTombstonesFrom(id) {
+		group.EntriesRead++
+	} else if s.entriesAdded > 0 {
+		group.EntriesRead = s.estimateEntriesRead(id)
+	}
+	group.LastDeliveredID = id
+}
+
+/** the number of entries the group still has to read. valid is false when it can't be known*/
+func (s *Stream) groupLag(group *ConsumerGroup) (lag int64, valid bool) {
+	if s.entriesAdded == 0 {
+		return 0, true
+	}
+	if group.EntriesRead != InvalidEntriesRead && !s.hasTombstonesFrom(group.LastDeliveredID) {
+		return s.entriesAdded - group.EntriesRead, true
+	}
+	entriesRead := s.estimateEntriesRead(group.LastDeliveredID)
+	if entriesRead == InvalidEntriesRead {
+		return 0, false
+	}
+	return s.entriesAdded - entriesRead, true
+}
+
+/**
+ * estimate the logical position of id counted from the first entry ever added.
+ * @return InvalidEntriesRead when deletions make it impossible to know
+ */
+func (s *Stream) estimateEntriesRead(id StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	length := int64(s.tree.Size())
+	if length == 0 && !s.lastID.LessThan(id) {
+		return s.entriesAdded
+	}
+	if id.Equal(s.lastID) {
+		return s.entriesAdded
+	}
+	if s.lastID.LessThan(id) {
+		return InvalidEntriesRead
+	}
+
+	first, _ := s.tree.Minimum()
+	firstID := first.(*StreamEntry).ID
+	if s.maxDeletedID.IsZero() || s.maxDeletedID.LessThan(firstID) {
+		// no deleted entries in the stream, so the position can be counted from the first entry
+		if id.LessThan(firstID) {
+			return s.entriesAdded - length
+		}
+		if id.Equal(firstID) {
+			return s.entriesAdded - length + 1
+		}
+	}
+	return InvalidEntriesRead
+}
+
+/** true if an entry deleted with XDEL lies at or after from*/
+func (s *Stream) hasTombstonesFrom(from StreamID) bool {
+	if s.tree.Size() == 0 || s.maxDeletedID.IsZero() {
+		return false
+	}
+	return !s.maxDeletedID.LessThan(from)
+}
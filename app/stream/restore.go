@@ -0,0 +1,67 @@
+package stream
+
+import (
+	art "github.com/plar/go-adaptive-radix-tree"
+)
+
+// RestoreEntry inserts an entry as is, without any id validation. Used when loading a stream from RDB.
+func (s *Stream) RestoreEntry(entry StreamEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.insertEntry(&entry)
+}
+
+// RestoreMeta sets the stream counters that can't be derived from the entries. Used when loading a stream from RDB.
+func (s *Stream) RestoreMeta(lastID, maxDeletedID StreamID, entriesAdded int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID = lastID
+	s.maxDeletedID = maxDeletedID
+	s.entriesAdded = entriesAdded
+}
+
+/**
+ * restore a consumer group as described by info, the inverse of the FULL form of Info.
+ * group pending entries are assigned to the consumers that list them in their own Pending,
+ * entries no consumer owns are dropped.
+ */
+func (s *Stream) RestoreGroup(info GroupInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.groups[info.Name]; exists {
+		return ErrBusyGroup
+	}
+
+	group := newConsumerGroup(info.Name, info.LastDeliveredID, info.EntriesRead)
+	groupPending := make(map[StreamID]PendingEntry, len(info.Pending))
+	for _, pendingEntry := range info.Pending {
+		groupPending[pendingEntry.ID] = pendingEntry
+	}
+
+	for _, consumerInfo := range info.Consumers {
+		consumer := &Consumer{
+			Name:       consumerInfo.Name,
+			SeenTime:   consumerInfo.SeenTime,
+			ActiveTime: consumerInfo.ActiveTime,
+			pending:    art.New(),
+		}
+		group.consumers[consumer.Name] = consumer
+
+		for _, owned := range consumerInfo.Pending {
+			pendingEntry, ok := groupPending[owned.ID]
+			if !ok {
+				continue
+			}
+			pendingEntry.Consumer = consumer.Name
+			restored := &pendingEntry
+			group.pending.Insert(encodeKey(restored.ID), restored)
+			consumer.pending.Insert(encodeKey(restored.ID), restored)
+		}
+	}
+
+	s.groups[info.Name] = group
+	return nil
+}
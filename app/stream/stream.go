@@ -1,93 +1,238 @@
 package stream
 
 import (
-	"fmt"
+	"errors"
+	"sort"
 	"sync"
 	"time"
 
 	art "github.com/plar/go-adaptive-radix-tree"
 )
 
+var (
+	ErrIDZero       = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	ErrIDNotGreater = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrInvalidID    = errors.New("ERR Invalid stream ID specified as stream command argument")
+)
+
 // Stream represents a Redis-like stream data structure.
 type Stream struct {
-	mu     sync.Mutex
-	tree   art.Tree
-	lastID StreamID
-}
-
-type StreamInsertRequest struct {
-	streamId   string
-	rawEntryId string
-	entries    map[string]string
+	mu   sync.Mutex
+	tree art.Tree
+	// the entries of tree in id order. the tree can't seek or iterate backwards, ranges use this instead
+	ordered []*StreamEntry
+	lastID  StreamID
+	// greatest id ever removed with XDEL, trimming doesn't count
+	maxDeletedID StreamID
+	// number of entries ever added to the stream, including deleted ones
+	entriesAdded int64
+	groups       map[string]*ConsumerGroup
 }
 
-/** insert the enrties to the given stream id. if the stream doesn't exist generate a new stream and insert the entries
- */
-// func ExecuteStreamEntryInsertion(insertionRequest StreamInsertRequest) (Stream, error) {
-
-// }
-
 // NewStream creates a new empty stream.
 func NewStream() *Stream {
 	return &Stream{
 		tree:   art.New(),
 		lastID: StreamID{Timestamp: 0, Sequence: 0},
+		groups: make(map[string]*ConsumerGroup),
+	}
+}
+
+/**
+ * add a new entry to the stream. rawID is the id as given to XADD: "*" generates
+ * the whole id, "<ms>-*" generates only the sequence and anything else is used as is.
+ * @return the id the entry was stored under
+ */
+func (s *Stream) Add(rawID string, fields []StreamField) (StreamID, error) {
+	if rawID == "*" {
+		return s.addEntry(StreamID{}, true, true, fields)
+	}
+
+	baseID, needAutoSeq, err := ParseStreamID(rawID)
+	if err != nil {
+		return StreamID{}, ErrInvalidID
+	}
+	return s.addEntry(baseID, false, needAutoSeq, fields)
+}
+
+// LastID returns the id of the last entry that was added to the stream.
+func (s *Stream) LastID() StreamID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// Len returns the number of entries in the stream.
+func (s *Stream) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tree.Size()
+}
+
+/**
+ * return a copy of the stream that later writes to s don't affect, e.g. for a snapshot that is
+ * encoded while clients keep writing. entries are never modified once added, so they are shared
+ */
+func (s *Stream) Clone() *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clone := &Stream{
+		tree:         art.New(),
+		lastID:       s.lastID,
+		maxDeletedID: s.maxDeletedID,
+		entriesAdded: s.entriesAdded,
+		groups:       make(map[string]*ConsumerGroup, len(s.groups)),
 	}
+	for _, entry := range s.ordered {
+		clone.insertEntry(entry)
+	}
+	for name, group := range s.groups {
+		clone.groups[name] = group.clone()
+	}
+	return clone
 }
 
-// AddEntry adds a new entry to the stream.
-// If needAutoSeq is true, it will compute a new sequence number for the timestamp.
-func (s *Stream) addEntry(baseID StreamID, needAutoSeq bool, fields map[string]string) (StreamID, error) {
+// addEntry adds a new entry to the stream.
+// If autoTimestamp is true the whole id is generated, if needAutoSeq is true only the sequence number is.
+func (s *Stream) addEntry(baseID StreamID, autoTimestamp, needAutoSeq bool, fields []StreamField) (StreamID, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	var id StreamID
 
-	if baseID.Timestamp == 0 && needAutoSeq {
-		// Full auto ID generation
+	if autoTimestamp {
+		// Full auto ID generation. never go back in time, even if the clock does
 		now := currentTimeMillis()
-		if now == s.lastID.Timestamp {
-			s.lastID.Sequence++
+		if now > s.lastID.Timestamp {
+			id = StreamID{Timestamp: now, Sequence: 0}
 		} else {
-			s.lastID.Timestamp = now
-			s.lastID.Sequence = 0
+			id = StreamID{Timestamp: s.lastID.Timestamp, Sequence: s.lastID.Sequence + 1}
 		}
-		id = s.lastID
 	} else {
 		// Manual timestamp or full ID provided
 		id.Timestamp = baseID.Timestamp
 		if needAutoSeq {
+			if id.Timestamp < s.lastID.Timestamp {
+				return StreamID{}, ErrIDNotGreater
+			}
 			id.Sequence = s.nextSequenceForTimestamp(id.Timestamp)
 		} else {
 			id.Sequence = baseID.Sequence
 		}
 
+		if id.IsZero() {
+			return StreamID{}, ErrIDZero
+		}
+
 		// Ensure new ID is greater than last inserted
 		if !s.lastID.LessThan(id) {
-			return StreamID{}, fmt.Errorf("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+			return StreamID{}, ErrIDNotGreater
 		}
-
-		s.lastID = id
 	}
 
+	s.lastID = id
+	s.entriesAdded++
+
 	// Store the entry
 	entry := &StreamEntry{
 		ID:     id,
 		Fields: fields,
 	}
-	s.tree.Insert(art.Key(id.String()), entry)
+	s.insertEntry(entry)
 	return id, nil
 }
 
+/** add entry to the tree and to ordered. caller must hold s.mu*/
+func (s *Stream) insertEntry(entry *StreamEntry) {
+	if _, updated := s.tree.Insert(encodeKey(entry.ID), entry); updated {
+		s.ordered[s.seek(entry.ID)] = entry
+		return
+	}
+	// new entries come last, unless they are restored out of order
+	if len(s.ordered) == 0 || s.ordered[len(s.ordered)-1].ID.LessThan(entry.ID) {
+		s.ordered = append(s.ordered, entry)
+		return
+	}
+	i := s.seek(entry.ID)
+	s.ordered = append(s.ordered, nil)
+	copy(s.ordered[i+1:], s.ordered[i:])
+	s.ordered[i] = entry
+}
+
+/** the index in ordered of the first entry with an id >= id. caller must hold s.mu*/
+func (s *Stream) seek(id StreamID) int {
+	return sort.Search(len(s.ordered), func(i int) bool {
+		return !s.ordered[i].ID.LessThan(id)
+	})
+}
+
 // nextSequenceForTimestamp finds the next available sequence for a given timestamp.
 func (s *Stream) nextSequenceForTimestamp(timestamp int64) int64 {
 	// Increment from the last sequence number used at this timestamp
 	if s.lastID.Timestamp == timestamp {
 		return s.lastID.Sequence + 1
 	}
+	// 0-0 is not a valid id, so the first sequence of timestamp 0 is 1
+	if timestamp == 0 {
+		return 1
+	}
 	return 0
 }
 
 func currentTimeMillis() int64 {
 	return time.Now().UnixNano() / int64(time.Millisecond)
 }
+
+func encodeKey(id StreamID) art.Key {
+	return art.Key(id.key())
+}
+
+/**
+ * return the entries with start <= id <= end in ascending order, or descending if reverse is set.
+ * count limits the number of returned entries, count <= 0 means no limit
+ */
+func (s *Stream) Range(start, end StreamID, count int, reverse bool) []StreamEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []StreamEntry{}
+	if end.LessThan(start) {
+		return entries
+	}
+
+	visit := func(entry *StreamEntry) bool {
+		entries = append(entries, *entry)
+		return count <= 0 || len(entries) < count
+	}
+	if reverse {
+		s.forEachInRangeReverse(start, end, visit)
+	} else {
+		s.forEachInRange(start, end, visit)
+	}
+	return entries
+}
+
+/**
+ * call fn for every entry with start <= id <= end in ascending order until fn returns false.
+ * the first entry is found with a binary search, so only the visited entries cost. caller must hold s.mu
+ */
+func (s *Stream) forEachInRange(start, end StreamID, fn func(entry *StreamEntry) bool) {
+	for i := s.seek(start); i < len(s.ordered) && !end.LessThan(s.ordered[i].ID); i++ {
+		if !fn(s.ordered[i]) {
+			return
+		}
+	}
+}
+
+/** like forEachInRange, in descending order starting from end. caller must hold s.mu*/
+func (s *Stream) forEachInRangeReverse(start, end StreamID, fn func(entry *StreamEntry) bool) {
+	last := sort.Search(len(s.ordered), func(i int) bool {
+		return end.LessThan(s.ordered[i].ID)
+	}) - 1
+	for i := last; i >= 0 && !s.ordered[i].ID.LessThan(start); i-- {
+		if !fn(s.ordered[i]) {
+			return
+		}
+	}
+}
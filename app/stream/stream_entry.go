@@ -3,5 +3,12 @@ package stream
 // StreamEntry represents a single entry in a Redis stream.
 type StreamEntry struct {
 	ID     StreamID
-	Fields map[string]string
+	Fields []StreamField
+}
+
+// StreamField is a single field-value pair of an entry. Fields are kept in
+// insertion order, as Redis replies with them in the order they were added.
+type StreamField struct {
+	Name  string
+	Value string
 }
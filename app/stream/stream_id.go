@@ -1,11 +1,18 @@
 package stream
 
 import (
+	"encoding/binary"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 )
 
+var (
+	MinID = StreamID{Timestamp: 0, Sequence: 0}
+	MaxID = StreamID{Timestamp: math.MaxInt64, Sequence: math.MaxInt64}
+)
+
 type StreamID struct {
 	Timestamp int64
 	Sequence  int64
@@ -15,25 +22,32 @@ func (id StreamID) String() string {
 	return fmt.Sprintf("%d-%d", id.Timestamp, id.Sequence)
 }
 
+/**
+ * parse an explicit stream id as accepted by XADD: "<ms>-<seq>", "<ms>-*" or "<ms>".
+ * needAutoSeq is true when the sequence part is "*" and has to be generated by the stream.
+ */
 func ParseStreamID(raw string) (StreamID, bool, error) {
 	parts := strings.Split(raw, "-")
 
 	switch len(parts) {
 	case 1:
 		timestamp, err := strconv.ParseInt(parts[0], 10, 64)
-		if err != nil {
-			return StreamID{}, false, fmt.Errorf("invalid timestamp in stream ID: %w", err)
+		if err != nil || timestamp < 0 {
+			return StreamID{}, false, fmt.Errorf("invalid timestamp in stream ID: %s", raw)
 		}
-		return StreamID{Timestamp: timestamp, Sequence: 0}, true, nil
+		return StreamID{Timestamp: timestamp, Sequence: 0}, false, nil
 
 	case 2:
 		timestamp, err := strconv.ParseInt(parts[0], 10, 64)
-		if err != nil {
-			return StreamID{}, false, fmt.Errorf("invalid timestamp in stream ID: %w", err)
+		if err != nil || timestamp < 0 {
+			return StreamID{}, false, fmt.Errorf("invalid timestamp in stream ID: %s", raw)
+		}
+		if parts[1] == "*" {
+			return StreamID{Timestamp: timestamp}, true, nil
 		}
 		sequence, err := strconv.ParseInt(parts[1], 10, 64)
-		if err != nil {
-			return StreamID{}, false, fmt.Errorf("invalid sequence in stream ID: %w", err)
+		if err != nil || sequence < 0 {
+			return StreamID{}, false, fmt.Errorf("invalid sequence in stream ID: %s", raw)
 		}
 		return StreamID{Timestamp: timestamp, Sequence: sequence}, false, nil
 
@@ -56,3 +70,68 @@ func (id StreamID) LessThan(other StreamID) bool {
 func (id StreamID) Equal(other StreamID) bool {
 	return id.Timestamp == other.Timestamp && id.Sequence == other.Sequence
 }
+
+// IsZero returns true for the 0-0 id, which is never a valid entry id
+func (id StreamID) IsZero() bool {
+	return id.Timestamp == 0 && id.Sequence == 0
+}
+
+/**
+ * parse an id used as a range boundary (XRANGE, XREVRANGE). "-" and "+" are the smallest and
+ * greatest possible ids and an incomplete id "<ms>" is completed with missingSeq.
+ */
+func ParseRangeID(raw string, missingSeq int64) (StreamID, error) {
+	switch raw {
+	case "-":
+		return MinID, nil
+	case "+":
+		return MaxID, nil
+	}
+
+	if !strings.Contains(raw, "-") {
+		timestamp, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || timestamp < 0 {
+			return StreamID{}, ErrInvalidID
+		}
+		return StreamID{Timestamp: timestamp, Sequence: missingSeq}, nil
+	}
+
+	id, needAutoSeq, err := ParseStreamID(raw)
+	if err != nil || needAutoSeq {
+		return StreamID{}, ErrInvalidID
+	}
+	return id, nil
+}
+
+// Next returns the id that directly follows this one. ok is false if id is already the greatest id
+func (id StreamID) Next() (next StreamID, ok bool) {
+	if id.Sequence < math.MaxInt64 {
+		return StreamID{Timestamp: id.Timestamp, Sequence: id.Sequence + 1}, true
+	}
+	if id.Timestamp < math.MaxInt64 {
+		return StreamID{Timestamp: id.Timestamp + 1, Sequence: 0}, true
+	}
+	return id, false
+}
+
+// Prev returns the id that directly precedes this one. ok is false if id is already the smallest id
+func (id StreamID) Prev() (prev StreamID, ok bool) {
+	if id.Sequence > 0 {
+		return StreamID{Timestamp: id.Timestamp, Sequence: id.Sequence - 1}, true
+	}
+	if id.Timestamp > 0 {
+		return StreamID{Timestamp: id.Timestamp - 1, Sequence: math.MaxInt64}, true
+	}
+	return id, false
+}
+
+/**
+ * encode the id as a fixed size big endian key, so the byte order of the keys in
+ * the radix tree is the numeric order of the ids ("9-0" before "10-0").
+ */
+func (id StreamID) key() []byte {
+	buf := make([]byte, 16)
+	binary.BigEndian.PutUint64(buf[:8], uint64(id.Timestamp))
+	binary.BigEndian.PutUint64(buf[8:], uint64(id.Sequence))
+	return buf
+}
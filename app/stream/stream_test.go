@@ -0,0 +1,212 @@
+package stream
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestRange_NumericOrder(t *testing.T) {
+	s := NewStream()
+	for _, raw := range []string{"9-0", "10-0", "10-2", "100-1"} {
+		if _, err := s.Add(raw, []StreamField{{Name: "f", Value: raw}}); err != nil {
+			t.Fatalf("add %s: %v", raw, err)
+		}
+	}
+
+	entries := s.Range(MinID, MaxID, 0, false)
+	got := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		got = append(got, entry.ID.String())
+	}
+
+	want := []string{"9-0", "10-0", "10-2", "100-1"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestRange_MatchesLinearScan(t *testing.T) {
+	s := NewStream()
+	rnd := rand.New(rand.NewSource(1))
+
+	var ids []StreamID
+	timestamp := int64(0)
+	for i := 0; i < 500; i++ {
+		timestamp += rnd.Int63n(300)
+		id, err := s.Add(StreamID{Timestamp: timestamp, Sequence: int64(i)}.String(), nil)
+		if err != nil {
+			t.Fatalf("add: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].LessThan(ids[j]) })
+
+	for i := 0; i < 200; i++ {
+		start := StreamID{Timestamp: rnd.Int63n(timestamp + 10), Sequence: rnd.Int63n(500)}
+		end := StreamID{Timestamp: rnd.Int63n(timestamp + 10), Sequence: rnd.Int63n(500)}
+		if i%10 == 0 {
+			end = start
+		}
+		count := rnd.Intn(5)
+		reverse := i%2 == 0
+
+		var want []StreamID
+		for _, id := range ids {
+			if !id.LessThan(start) && !end.LessThan(id) {
+				want = append(want, id)
+			}
+		}
+		if reverse {
+			for l, r := 0, len(want)-1; l < r; l, r = l+1, r-1 {
+				want[l], want[r] = want[r], want[l]
+			}
+		}
+		if count > 0 && len(want) > count {
+			want = want[:count]
+		}
+
+		got := s.Range(start, end, count, reverse)
+		if len(got) != len(want) {
+			t.Fatalf("range %s..%s count %d reverse %v: expected %d entries, got %d", start, end, count, reverse, len(want), len(got))
+		}
+		for j := range want {
+			if !got[j].ID.Equal(want[j]) {
+				t.Fatalf("range %s..%s: expected %s at %d, got %s", start, end, want[j], j, got[j].ID)
+			}
+		}
+	}
+}
+
+func TestParseRangeID(t *testing.T) {
+	tests := []struct {
+		raw        string
+		missingSeq int64
+		want       StreamID
+	}{
+		{"-", 0, MinID},
+		{"+", 0, MaxID},
+		{"1526985054069", 0, StreamID{Timestamp: 1526985054069, Sequence: 0}},
+		{"1526985054069", MaxID.Sequence, StreamID{Timestamp: 1526985054069, Sequence: MaxID.Sequence}},
+		{"5-3", 0, StreamID{Timestamp: 5, Sequence: 3}},
+	}
+
+	for _, test := range tests {
+		got, err := ParseRangeID(test.raw, test.missingSeq)
+		if err != nil {
+			t.Fatalf("parse %s: %v", test.raw, err)
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("parse %s: expected %s, got %s", test.raw, test.want, got)
+		}
+	}
+
+	if _, err := ParseRangeID("5-*", 0); err == nil {
+		t.Errorf("expected an error for 5-*")
+	}
+}
+
+func TestClone_IsIndependent(t *testing.T) {
+	s := NewStream()
+	s.Add("1-0", []StreamField{{Name: "f", Value: "1"}})
+	s.Add("2-0", []StreamField{{Name: "f", Value: "2"}})
+	s.CreateGroup("g", MinID, 0)
+	s.ReadGroupNew("g", "alice", 1, false)
+
+	clone := s.Clone()
+	s.Add("3-0", []StreamField{{Name: "f", Value: "3"}})
+	s.ReadGroupNew("g", "alice", 0, false)
+	s.Claim("g", "bob", 0, []StreamID{{Timestamp: 1}}, ClaimOptions{})
+
+	if clone.Len() != 2 || clone.LastID() != (StreamID{Timestamp: 2}) {
+		t.Fatalf("clone changed with the stream: len %d, last id %v", clone.Len(), clone.LastID())
+	}
+	lastID, _, _ := clone.GroupPosition("g")
+	if lastID != (StreamID{Timestamp: 1}) {
+		t.Fatalf("clone group moved to %v", lastID)
+	}
+	pendingEntry, ok := clone.Pending("g", StreamID{Timestamp: 1})
+	if !ok || pendingEntry.Consumer != "alice" || pendingEntry.DeliveryCount != 1 {
+		t.Fatalf("clone pending entry changed: %+v", pendingEntry)
+	}
+	consumers, _ := clone.ConsumersInfo("g")
+	if len(consumers) != 1 || consumers[0].PelCount != 1 {
+		t.Fatalf("clone consumers changed: %+v", consumers)
+	}
+}
+
+func TestRange_AfterDeletesTrimsAndRestores(t *testing.T) {
+	s := NewStream()
+	// restored entries may arrive in any order
+	for _, seq := range []int64{5, 1, 3, 2, 4, 6, 7, 8, 9, 10} {
+		s.RestoreEntry(StreamEntry{ID: StreamID{Timestamp: 1, Sequence: seq}})
+	}
+	s.Delete([]StreamID{{Timestamp: 1, Sequence: 4}, {Timestamp: 1, Sequence: 8}})
+	s.Trim(TrimOptions{Strategy: TrimMinID, MinID: StreamID{Timestamp: 1, Sequence: 3}})
+	s.Add("1-11", nil)
+
+	ids := func(entries []StreamEntry) []string {
+		got := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			got = append(got, entry.ID.String())
+		}
+		return got
+	}
+	assertIDs := func(got []StreamEntry, want ...string) {
+		t.Helper()
+		if strings.Join(ids(got), " ") != strings.Join(want, " ") {
+			t.Fatalf("expected %v, got %v", want, ids(got))
+		}
+	}
+
+	assertIDs(s.Range(MinID, MaxID, 0, false), "1-3", "1-5", "1-6", "1-7", "1-9", "1-10", "1-11")
+	assertIDs(s.Range(StreamID{Timestamp: 1, Sequence: 4}, StreamID{Timestamp: 1, Sequence: 9}, 2, false), "1-5", "1-6")
+	assertIDs(s.Range(StreamID{Timestamp: 1, Sequence: 4}, StreamID{Timestamp: 1, Sequence: 8}, 2, true), "1-7", "1-6")
+	assertIDs(s.Range(MinID, MaxID, 3, true), "1-11", "1-10", "1-9")
+	assertIDs(s.Range(StreamID{Timestamp: 1, Sequence: 8}, StreamID{Timestamp: 1, Sequence: 8}, 0, true))
+
+	if removed := s.Trim(TrimOptions{Strategy: TrimMaxLen, MaxLen: 2}); removed != 5 {
+		t.Fatalf("expected 5 trimmed entries, got %d", removed)
+	}
+	assertIDs(s.Range(MinID, MaxID, 0, true), "1-11", "1-10")
+}
+
+func TestAutoClaim_DeletedEntriesCountAgainstCount(t *testing.T) {
+	s := NewStream()
+	for _, raw := range []string{"1-0", "2-0", "3-0", "4-0"} {
+		s.Add(raw, []StreamField{{Name: "f", Value: raw}})
+	}
+	s.CreateGroup("g", MinID, 0)
+	s.ReadGroupNew("g", "alice", 0, false)
+	s.Delete([]StreamID{{Timestamp: 1}, {Timestamp: 2}})
+
+	next, claimed, deleted, _ := s.AutoClaim("g", "bob", 0, MinID, 2, false)
+	if len(claimed) != 0 || len(deleted) != 2 || next != (StreamID{Timestamp: 3}) {
+		t.Fatalf("expected 2 deleted ids and cursor 3-0, got claimed %v, deleted %v, cursor %v", claimed, deleted, next)
+	}
+
+	next, claimed, deleted, _ = s.AutoClaim("g", "bob", 0, next, 2, false)
+	if len(claimed) != 2 || len(deleted) != 0 || next != MinID {
+		t.Fatalf("expected 2 claimed entries and a complete scan, got claimed %v, deleted %v, cursor %v", claimed, deleted, next)
+	}
+}
+
+func TestClaim_FutureTimeIsNow(t *testing.T) {
+	s := NewStream()
+	s.Add("1-0", nil)
+	s.CreateGroup("g", MinID, 0)
+	s.ReadGroupNew("g", "alice", 0, false)
+
+	future := currentTimeMillis() + 60000
+	s.Claim("g", "bob", 0, []StreamID{{Timestamp: 1}}, ClaimOptions{Time: &future})
+	pendingEntry, _ := s.Pending("g", StreamID{Timestamp: 1})
+	if pendingEntry.DeliveryTime > currentTimeMillis() {
+		t.Fatalf("delivery time %d is in the future", pendingEntry.DeliveryTime)
+	}
+}
@@ -0,0 +1,104 @@
+package stream
+
+// NodeMaxEntries is the number of entries that make up a chunk of the stream,
+// approximate trimming only ever removes whole chunks.
+const NodeMaxEntries = 100
+
+type TrimStrategy int
+
+const (
+	TrimMaxLen TrimStrategy = iota
+	TrimMinID
+)
+
+// TrimOptions describe a XTRIM, or the trimming part of a XADD.
+type TrimOptions struct {
+	Strategy TrimStrategy
+	MaxLen   int64
+	MinID    StreamID
+	// Approx allows keeping more entries than asked, so only whole chunks are removed
+	Approx bool
+	// Limit caps the number of removed entries of an approximate trim. 0 means no limit
+	Limit int64
+}
+
+/**
+ * remove entries from the head of the stream according to opts.
+ * @return the number of removed entries
+ */
+func (s *Stream) Trim(opts TrimOptions) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var toRemove int64
+	switch opts.Strategy {
+	case TrimMaxLen:
+		toRemove = int64(s.tree.Size()) - opts.MaxLen
+	case TrimMinID:
+		toRemove = int64(s.seek(opts.MinID))
+	}
+
+	if opts.Approx {
+		if opts.Limit > 0 && toRemove > opts.Limit {
+			toRemove = opts.Limit
+		}
+		toRemove -= toRemove % NodeMaxEntries
+	}
+	if toRemove <= 0 {
+		return 0
+	}
+
+	removed := s.ordered[:toRemove]
+	for i, entry := range removed {
+		s.tree.Delete(encodeKey(entry.ID))
+		removed[i] = nil
+	}
+	// the next append that outgrows the slice leaves the removed head behind
+	s.ordered = s.ordered[toRemove:]
+	return toRemove
+}
+
+/**
+ * delete the entries with the given ids. pending entries of consumer groups are kept,
+ * as in Redis they are only cleaned up once claimed or acknowledged.
+ * @return the number of entries that existed and were deleted
+ */
+func (s *Stream) Delete(ids []StreamID) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for _, id := range ids {
+		if s.deleteEntry(id) {
+			deleted++
+			if s.maxDeletedID.LessThan(id) {
+				s.maxDeletedID = id
+			}
+		}
+	}
+	return deleted
+}
+
+/** remove a single entry from the stream. caller must hold s.mu*/
+func (s *Stream) deleteEntry(id StreamID) bool {
+	if _, deleted := s.tree.Delete(encodeKey(id)); !deleted {
+		return false
+	}
+	i := s.seek(id)
+	copy(s.ordered[i:], s.ordered[i+1:])
+	s.ordered[len(s.ordered)-1] = nil
+	s.ordered = s.ordered[:len(s.ordered)-1]
+	return true
+}
+
+// FirstID returns the id of the first entry in the stream. ok is false if the stream is empty
+func (s *Stream) FirstID() (id StreamID, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	first, ok := s.tree.Minimum()
+	if !ok {
+		return StreamID{}, false
+	}
+	return first.(*StreamEntry).ID, true
+}
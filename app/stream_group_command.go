@@ -0,0 +1,712 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+)
+
+type XGroupCommand struct {
+	BaseWriteCommand
+	values []RESPValue
+	// whether the subcommand changed a group, a failed or no-op one is not replicated
+	changed bool
+}
+
+func (xGroup *XGroupCommand) Name() string      { return CommandXGROUP }
+func (xGroup *XGroupCommand) Args() []RESPValue { return xGroup.values[1:] }
+
+func (xGroup *XGroupCommand) Execute(ctx CommandContext) RESPValue {
+	args := xGroup.Args()
+	if len(args) < 3 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xgroup' command"}
+	}
+
+	subCmd := strings.ToUpper(args[0].String)
+	key := args[1].String
+	groupName := args[2].String
+
+	if subCmd == "CREATE" {
+		resp := xGroup.create(args[1:])
+		xGroup.changed = resp.Type != Error
+		return resp
+	}
+
+	s, err := getStream(key)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Error, String: "ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."}
+	}
+
+	switch subCmd {
+	case "SETID":
+		if len(args) != 4 && len(args) != 6 {
+			return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xgroup|setid' command"}
+		}
+		id, err := parseGroupStreamID(s, args[3].String)
+		if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		entriesRead := stream.InvalidEntriesRead
+		if len(args) == 6 {
+			if strings.ToUpper(args[4].String) != "ENTRIESREAD" {
+				return RESPValue{Type: Error, String: "ERR syntax error"}
+			}
+			if entriesRead, err = parseEntriesRead(args[5].String); err != nil {
+				return RESPValue{Type: Error, String: err.Error()}
+			}
+		}
+		if err := s.SetGroupID(groupName, id, entriesRead); err != nil {
+			return xGroupNoGroupError(key, groupName)
+		}
+		xGroup.changed = true
+		return RESPValue{Type: SimpleString, String: "OK"}
+
+	case "DESTROY":
+		if len(args) != 3 {
+			return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xgroup|destroy' command"}
+		}
+		if s.DestroyGroup(groupName) {
+			xGroup.changed = true
+			return RESPValue{Type: Integer, Integer: 1}
+		}
+		return RESPValue{Type: Integer, Integer: 0}
+
+	case "CREATECONSUMER":
+		if len(args) != 4 {
+			return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xgroup|createconsumer' command"}
+		}
+		created, err := s.CreateConsumer(groupName, args[3].String)
+		if errors.Is(err, stream.ErrNoGroup) {
+			return xGroupNoGroupError(key, groupName)
+		} else if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		if created {
+			xGroup.changed = true
+			return RESPValue{Type: Integer, Integer: 1}
+		}
+		return RESPValue{Type: Integer, Integer: 0}
+
+	case "DELCONSUMER":
+		if len(args) != 4 {
+			return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xgroup|delconsumer' command"}
+		}
+		pending, deleted, err := s.DeleteConsumer(groupName, args[3].String)
+		if err != nil {
+			return xGroupNoGroupError(key, groupName)
+		}
+		xGroup.changed = deleted
+		return RESPValue{Type: Integer, Integer: int64(pending)}
+	}
+
+	return RESPValue{Type: Error, String: fmt.Sprintf("ERR unknown subcommand '%s'. Try XGROUP HELP.", args[0].String)}
+}
+
+/** XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD n]*/
+func (xGroup *XGroupCommand) create(args []RESPValue) RESPValue {
+	if len(args) < 3 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xgroup|create' command"}
+	}
+
+	key, groupName, rawID := args[0].String, args[1].String, args[2].String
+	mkStream := false
+	entriesRead := stream.InvalidEntriesRead
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i].String) {
+		case "MKSTREAM":
+			mkStream = true
+		case "ENTRIESREAD":
+			if i+1 >= len(args) {
+				return RESPValue{Type: Error, String: "ERR syntax error"}
+			}
+			var err error
+			if entriesRead, err = parseEntriesRead(args[i+1].String); err != nil {
+				return RESPValue{Type: Error, String: err.Error()}
+			}
+			i++
+		default:
+			return RESPValue{Type: Error, String: "ERR syntax error"}
+		}
+	}
+
+	// validated before MKSTREAM creates anything, a failed CREATE must leave no stream behind
+	if rawID != "$" {
+		if _, err := parseStrictStreamID(rawID); err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+	}
+
+	var s *stream.Stream
+	var err error
+	if mkStream {
+		s, _, err = getOrCreateStream(key)
+	} else {
+		s, err = getStream(key)
+	}
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Error, String: "ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."}
+	}
+
+	id, err := parseGroupStreamID(s, rawID)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if err := s.CreateGroup(groupName, id, entriesRead); err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	return RESPValue{Type: SimpleString, String: "OK"}
+}
+
+func (xGroup *XGroupCommand) ShouldReplicate() bool {
+	return xGroup.changed
+}
+
+func parseEntriesRead(raw string) (int64, error) {
+	entriesRead, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return 0, errors.New("ERR value is not an integer or out of range")
+	}
+	if entriesRead < 0 && entriesRead != stream.InvalidEntriesRead {
+		return 0, errors.New("ERR value for ENTRIESREAD must be positive or -1")
+	}
+	return entriesRead, nil
+}
+
+func xGroupNoGroupError(key, group string) RESPValue {
+	return RESPValue{Type: Error, String: fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key)}
+}
+
+type XReadGroupCommand struct {
+	BaseWriteCommand
+	values []RESPValue
+	// what the read changed in the groups, in the form replicas and the AOF get it
+	propagation []RESPValue
+}
+
+func (xReadGroup *XReadGroupCommand) Name() string      { return CommandXREADGROUP }
+func (xReadGroup *XReadGroupCommand) Args() []RESPValue { return xReadGroup.values[1:] }
+
+func (xReadGroup *XReadGroupCommand) Execute(ctx CommandContext) RESPValue {
+	opts, err := parseStreamReadOptions(xReadGroup.Args(), true)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+
+	// ">" reads new entries, any other id reads the consumer's pending entries after it
+	readsNew := true
+	afterIDs := make([]stream.StreamID, len(opts.keys))
+	for i, key := range opts.keys {
+		s, err := getStream(key)
+		if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		if s == nil || !s.HasGroup(opts.group) {
+			return RESPValue{Type: Error, String: xReadGroupNoGroupError(key, opts.group).Error()}
+		}
+		if opts.ids[i] == ">" {
+			continue
+		}
+		readsNew = false
+		id, err := parseStrictStreamID(opts.ids[i])
+		if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		afterIDs[i] = id
+	}
+
+	// history reads never block and always reply with every stream
+	var waiter *streamWaiter
+	if opts.block >= 0 && readsNew {
+		waiter = streamWaiters.register(opts.keys...)
+		defer streamWaiters.unregister(waiter)
+	}
+
+	// the new entries every stream delivered in the last read
+	var delivered map[string][]stream.StreamID
+	resp := waitForStreams(ctx.writeLock, waiter, opts.block, func() ([]RESPValue, error) {
+		var result []RESPValue
+		delivered = map[string][]stream.StreamID{}
+		for i, key := range opts.keys {
+			s, err := getStream(key)
+			if err != nil {
+				return nil, err
+			}
+			if s == nil {
+				return nil, xReadGroupNoGroupError(key, opts.group)
+			}
+
+			var entries []stream.StreamEntry
+			if opts.ids[i] == ">" {
+				entries, err = s.ReadGroupNew(opts.group, opts.consumer, opts.count, opts.noAck)
+			} else {
+				entries, err = s.ReadGroupPending(opts.group, opts.consumer, afterIDs[i], opts.count)
+			}
+			if errors.Is(err, stream.ErrNoGroup) {
+				return nil, xReadGroupNoGroupError(key, opts.group)
+			} else if err != nil {
+				return nil, err
+			}
+
+			if len(entries) == 0 && opts.ids[i] == ">" {
+				continue
+			}
+			if opts.ids[i] == ">" {
+				delivered[key] = entryIDsOf(entries)
+			}
+			result = append(result, RESPValue{
+				Type: Array,
+				Array: []RESPValue{
+					{Type: BulkString, String: key},
+					streamEntriesToRESP(entries),
+				},
+			})
+		}
+		return result, nil
+	})
+
+	if resp.Type == Array {
+		for _, key := range opts.keys {
+			ids, ok := delivered[key]
+			if !ok {
+				continue
+			}
+			s, _ := getStream(key)
+			if !opts.noAck {
+				xReadGroup.propagation = append(xReadGroup.propagation, pendingPropagation(s, key, opts.group, opts.consumer, ids, nil)...)
+			}
+			xReadGroup.propagation = append(xReadGroup.propagation, groupPositionPropagation(s, key, opts.group)...)
+		}
+	}
+	return resp
+}
+
+func xReadGroupNoGroupError(key, group string) error {
+	return fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, group)
+}
+
+/** only a read that delivered new entries changes the group state*/
+func (xReadGroup *XReadGroupCommand) ShouldReplicate() bool {
+	return len(xReadGroup.propagation) > 0
+}
+
+/** a read is propagated as the XCLAIMs and the XGROUP SETID that recreate its effect, never blocking*/
+func (xReadGroup *XReadGroupCommand) PropagatedValues(original RESPValue) []RESPValue {
+	return xReadGroup.propagation
+}
+
+type XAckCommand struct {
+	BaseWriteCommand
+	values []RESPValue
+	acked  int
+}
+
+func (xAck *XAckCommand) Name() string      { return CommandXACK }
+func (xAck *XAckCommand) Args() []RESPValue { return xAck.values[1:] }
+
+func (xAck *XAckCommand) Execute(ctx CommandContext) RESPValue {
+	args := xAck.Args()
+	if len(args) < 3 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xack' command"}
+	}
+
+	ids := make([]stream.StreamID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, err := parseStrictStreamID(arg.String)
+		if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		ids = append(ids, id)
+	}
+
+	s, err := getStream(args[0].String)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Integer, Integer: 0}
+	}
+
+	acked, err := s.Ack(args[1].String, ids)
+	if err != nil {
+		return RESPValue{Type: Integer, Integer: 0}
+	}
+	xAck.acked = acked
+	return RESPValue{Type: Integer, Integer: int64(acked)}
+}
+
+/** acking ids that were not pending changes nothing*/
+func (xAck *XAckCommand) ShouldReplicate() bool {
+	return xAck.acked > 0
+}
+
+type XPendingCommand struct {
+	values []RESPValue
+}
+
+func (xPending *XPendingCommand) Name() string      { return CommandXPENDING }
+func (xPending *XPendingCommand) Args() []RESPValue { return xPending.values[1:] }
+
+func (xPending *XPendingCommand) Execute(ctx CommandContext) RESPValue {
+	args := xPending.Args()
+	if len(args) < 2 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xpending' command"}
+	}
+
+	key, groupName := args[0].String, args[1].String
+	s, errResp := getStreamWithGroup(key, groupName)
+	if errResp != nil {
+		return *errResp
+	}
+
+	if len(args) == 2 {
+		return xPendingSummary(s, groupName)
+	}
+
+	filter := stream.PendingFilter{}
+	rangeArgs := args[2:]
+	if strings.ToUpper(rangeArgs[0].String) == "IDLE" {
+		if len(rangeArgs) < 2 {
+			return RESPValue{Type: Error, String: "ERR syntax error"}
+		}
+		minIdle, err := strconv.ParseInt(rangeArgs[1].String, 10, 64)
+		if err != nil {
+			return RESPValue{Type: Error, String: "ERR value is not an integer or out of range"}
+		}
+		filter.MinIdle = minIdle
+		rangeArgs = rangeArgs[2:]
+	}
+	if len(rangeArgs) != 3 && len(rangeArgs) != 4 {
+		return RESPValue{Type: Error, String: "ERR syntax error"}
+	}
+
+	var err error
+	if filter.Start, err = parseIntervalID(rangeArgs[0].String, 0, true); err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if filter.End, err = parseIntervalID(rangeArgs[1].String, stream.MaxID.Sequence, false); err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if filter.Count, err = strconv.Atoi(rangeArgs[2].String); err != nil {
+		return RESPValue{Type: Error, String: "ERR value is not an integer or out of range"}
+	}
+	if len(rangeArgs) == 4 {
+		filter.Consumer = rangeArgs[3].String
+	}
+
+	pendingEntries, err := s.PendingRange(groupName, filter)
+	if err != nil {
+		return noGroupError(key, groupName)
+	}
+
+	now := currentTimeMillis()
+	result := make([]RESPValue, 0, len(pendingEntries))
+	for _, pendingEntry := range pendingEntries {
+		result = append(result, RESPValue{
+			Type: Array,
+			Array: []RESPValue{
+				{Type: BulkString, String: pendingEntry.ID.String()},
+				{Type: BulkString, String: pendingEntry.Consumer},
+				{Type: Integer, Integer: now - pendingEntry.DeliveryTime},
+				{Type: Integer, Integer: pendingEntry.DeliveryCount},
+			},
+		})
+	}
+	return RESPValue{Type: Array, Array: result}
+}
+
+func xPendingSummary(s *stream.Stream, groupName string) RESPValue {
+	summary, err := s.PendingSummary(groupName)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+
+	if summary.Count == 0 {
+		return RESPValue{
+			Type: Array,
+			Array: []RESPValue{
+				{Type: Integer, Integer: 0},
+				{Type: BulkString, IsNil: true},
+				{Type: BulkString, IsNil: true},
+				{Type: Array, Array: nil},
+			},
+		}
+	}
+
+	consumers := make([]RESPValue, 0, len(summary.Consumers))
+	for _, consumer := range summary.Consumers {
+		consumers = append(consumers, RESPValue{
+			Type: Array,
+			Array: []RESPValue{
+				{Type: BulkString, String: consumer.Name},
+				{Type: BulkString, String: strconv.Itoa(consumer.Count)},
+			},
+		})
+	}
+
+	return RESPValue{
+		Type: Array,
+		Array: []RESPValue{
+			{Type: Integer, Integer: int64(summary.Count)},
+			{Type: BulkString, String: summary.MinID.String()},
+			{Type: BulkString, String: summary.MaxID.String()},
+			{Type: Array, Array: consumers},
+		},
+	}
+}
+
+type XClaimCommand struct {
+	BaseWriteCommand
+	values      []RESPValue
+	propagation []RESPValue
+}
+
+func (xClaim *XClaimCommand) Name() string      { return CommandXCLAIM }
+func (xClaim *XClaimCommand) Args() []RESPValue { return xClaim.values[1:] }
+
+/** XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME ms] [RETRYCOUNT n] [FORCE] [JUSTID] [LASTID id]*/
+func (xClaim *XClaimCommand) Execute(ctx CommandContext) RESPValue {
+	args := xClaim.Args()
+	if len(args) < 5 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xclaim' command"}
+	}
+
+	key, groupName, consumerName := args[0].String, args[1].String, args[2].String
+	minIdle, err := strconv.ParseInt(args[3].String, 10, 64)
+	if err != nil {
+		return RESPValue{Type: Error, String: "ERR Invalid min-idle-time argument for XCLAIM"}
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+
+	var ids []stream.StreamID
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := parseStrictStreamID(args[i].String)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	opts := stream.ClaimOptions{}
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i].String)
+		switch option {
+		case "FORCE":
+			opts.Force = true
+			continue
+		case "JUSTID":
+			opts.JustID = true
+			continue
+		}
+
+		if i+1 >= len(args) {
+			return RESPValue{Type: Error, String: fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", args[i].String)}
+		}
+		value := args[i+1].String
+		i++
+
+		switch option {
+		case "IDLE", "TIME", "RETRYCOUNT":
+			num, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return RESPValue{Type: Error, String: fmt.Sprintf("ERR Invalid %s option argument for XCLAIM", option)}
+			}
+			switch option {
+			case "IDLE":
+				opts.Idle = &num
+			case "TIME":
+				opts.Time = &num
+			case "RETRYCOUNT":
+				opts.RetryCount = &num
+			}
+		case "LASTID":
+			lastID, err := parseStrictStreamID(value)
+			if err != nil {
+				return RESPValue{Type: Error, String: err.Error()}
+			}
+			opts.LastID = &lastID
+		default:
+			return RESPValue{Type: Error, String: fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", args[i-1].String)}
+		}
+	}
+
+	s, errResp := getStreamWithGroup(key, groupName)
+	if errResp != nil {
+		return *errResp
+	}
+
+	claimed, deleted, err := s.Claim(groupName, consumerName, minIdle, ids, opts)
+	if errors.Is(err, stream.ErrNoGroup) {
+		return noGroupError(key, groupName)
+	} else if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	xClaim.propagation = pendingPropagation(s, key, groupName, consumerName, entryIDsOf(claimed), deleted)
+	if opts.LastID != nil && len(xClaim.propagation) == 0 {
+		// LASTID alone may still have moved the group forward
+		xClaim.propagation = groupPositionPropagation(s, key, groupName)
+	}
+
+	if opts.JustID {
+		return streamIDsToRESP(entryIDsOf(claimed))
+	}
+	return streamEntriesToRESP(claimed)
+}
+
+func (xClaim *XClaimCommand) ShouldReplicate() bool {
+	return len(xClaim.propagation) > 0
+}
+
+/** claims are propagated with the delivery time and count they ended up with, not the local idle times*/
+func (xClaim *XClaimCommand) PropagatedValues(original RESPValue) []RESPValue {
+	return xClaim.propagation
+}
+
+type XAutoClaimCommand struct {
+	BaseWriteCommand
+	values      []RESPValue
+	propagation []RESPValue
+}
+
+func (xAutoClaim *XAutoClaimCommand) Name() string      { return CommandXAUTOCLAIM }
+func (xAutoClaim *XAutoClaimCommand) Args() []RESPValue { return xAutoClaim.values[1:] }
+
+/** XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]*/
+func (xAutoClaim *XAutoClaimCommand) Execute(ctx CommandContext) RESPValue {
+	args := xAutoClaim.Args()
+	if len(args) < 5 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xautoclaim' command"}
+	}
+
+	key, groupName, consumerName := args[0].String, args[1].String, args[2].String
+	minIdle, err := strconv.ParseInt(args[3].String, 10, 64)
+	if err != nil {
+		return RESPValue{Type: Error, String: "ERR Invalid min-idle-time argument for XAUTOCLAIM"}
+	}
+	if minIdle < 0 {
+		minIdle = 0
+	}
+
+	start, err := parseIntervalID(args[4].String, 0, true)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i].String) {
+		case "COUNT":
+			if i+1 >= len(args) {
+				return RESPValue{Type: Error, String: "ERR syntax error"}
+			}
+			count, err = strconv.Atoi(args[i+1].String)
+			if err != nil || count < 1 {
+				return RESPValue{Type: Error, String: "ERR COUNT must be > 0"}
+			}
+			i++
+		case "JUSTID":
+			justID = true
+		default:
+			return RESPValue{Type: Error, String: "ERR syntax error"}
+		}
+	}
+
+	s, errResp := getStreamWithGroup(key, groupName)
+	if errResp != nil {
+		return *errResp
+	}
+
+	next, claimed, deleted, err := s.AutoClaim(groupName, consumerName, minIdle, start, count, justID)
+	if errors.Is(err, stream.ErrNoGroup) {
+		return noGroupError(key, groupName)
+	} else if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	xAutoClaim.propagation = pendingPropagation(s, key, groupName, consumerName, entryIDsOf(claimed), deleted)
+
+	claimedResp := streamEntriesToRESP(claimed)
+	if justID {
+		claimedResp = streamIDsToRESP(entryIDsOf(claimed))
+	}
+
+	return RESPValue{
+		Type: Array,
+		Array: []RESPValue{
+			{Type: BulkString, String: next.String()},
+			claimedResp,
+			streamIDsToRESP(deleted),
+		},
+	}
+}
+
+func (xAutoClaim *XAutoClaimCommand) ShouldReplicate() bool {
+	return len(xAutoClaim.propagation) > 0
+}
+
+/** the scan depends on the local clock, so what it claimed and dropped is propagated as plain XCLAIMs*/
+func (xAutoClaim *XAutoClaimCommand) PropagatedValues(original RESPValue) []RESPValue {
+	return xAutoClaim.propagation
+}
+
+func entryIDsOf(entries []stream.StreamEntry) []stream.StreamID {
+	ids := make([]stream.StreamID, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+/**
+ * the deterministic form of a change to pending entries, the way Redis propagates it: an XCLAIM per pending id
+ * that sets its owner, delivery time and delivery count, and an XCLAIM per dropped id, which drops it on the
+ * replica too since the entry is gone from the stream there as well
+ */
+func pendingPropagation(s *stream.Stream, key, groupName, consumerName string, ids, dropped []stream.StreamID) []RESPValue {
+	lastID, _, err := s.GroupPosition(groupName)
+	if err != nil {
+		return nil
+	}
+
+	var propagation []RESPValue
+	for _, id := range ids {
+		pendingEntry, ok := s.Pending(groupName, id)
+		if !ok {
+			continue
+		}
+		propagation = append(propagation, RESPValue{Type: Array, Array: bulkStrings(
+			CommandXCLAIM, key, groupName, pendingEntry.Consumer, "0", id.String(),
+			"TIME", strconv.FormatInt(pendingEntry.DeliveryTime, 10),
+			"RETRYCOUNT", strconv.FormatInt(pendingEntry.DeliveryCount, 10),
+			"FORCE", "JUSTID", "LASTID", lastID.String(),
+		)})
+	}
+	for _, id := range dropped {
+		propagation = append(propagation, RESPValue{Type: Array, Array: bulkStrings(
+			CommandXCLAIM, key, groupName, consumerName, "0", id.String(), "JUSTID", "LASTID", lastID.String(),
+		)})
+	}
+	return propagation
+}
+
+/** XGROUP SETID with the group's last delivered id and read counter*/
+func groupPositionPropagation(s *stream.Stream, key, groupName string) []RESPValue {
+	lastID, entriesRead, err := s.GroupPosition(groupName)
+	if err != nil {
+		return nil
+	}
+	return []RESPValue{{Type: Array, Array: bulkStrings(
+		CommandXGROUP, "SETID", key, groupName, lastID.String(), "ENTRIESREAD", strconv.FormatInt(entriesRead, 10),
+	)}}
+}
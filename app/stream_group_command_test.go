@@ -0,0 +1,244 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func execute(factory CommandFactory, args ...string) RESPValue {
+	return factory(bulkArgs(args...)).Execute(CommandContext{})
+}
+
+func TestXGroupCommand_Create(t *testing.T) {
+	ResetStore()
+
+	resp := execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "$")
+	assert.Equal(t, Error, resp.Type)
+
+	resp = execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "$", "MKSTREAM")
+	assert.Equal(t, RESPValue{Type: SimpleString, String: "OK"}, resp)
+
+	resp = execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	assert.Equal(t, "BUSYGROUP Consumer Group name already exists", resp.String)
+
+	resp = execute(NewXGroupCommand, CommandXGROUP, "CREATECONSUMER", "events", "workers", "alice")
+	assert.Equal(t, int64(1), resp.Integer)
+	resp = execute(NewXGroupCommand, CommandXGROUP, "CREATECONSUMER", "events", "workers", "alice")
+	assert.Equal(t, int64(0), resp.Integer)
+
+	resp = execute(NewXGroupCommand, CommandXGROUP, "DESTROY", "events", "workers")
+	assert.Equal(t, int64(1), resp.Integer)
+	resp = execute(NewXGroupCommand, CommandXGROUP, "DESTROY", "events", "workers")
+	assert.Equal(t, int64(0), resp.Integer)
+}
+
+func TestXReadGroupCommand_DeliveryAndAck(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "1")
+	xAdd("events", "2-0", "n", "2")
+	xAdd("events", "3-0", "n", "3")
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+
+	resp := execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "COUNT", "2", "STREAMS", "events", ">")
+	assert.Equal(t, []string{"1-0", "2-0"}, entryIDs(resp.Array[0].Array[1]))
+
+	resp = execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "bob", "STREAMS", "events", ">")
+	assert.Equal(t, []string{"3-0"}, entryIDs(resp.Array[0].Array[1]))
+
+	// nothing new left for the group
+	resp = execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "bob", "STREAMS", "events", ">")
+	assert.Nil(t, resp.Array)
+
+	// history of alice only holds her own pending entries
+	resp = execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "STREAMS", "events", "0")
+	assert.Equal(t, []string{"1-0", "2-0"}, entryIDs(resp.Array[0].Array[1]))
+
+	resp = execute(NewXAckCommand, CommandXACK, "events", "workers", "1-0", "3-0", "9-0")
+	assert.Equal(t, int64(2), resp.Integer)
+
+	resp = execute(NewXPendingCommand, CommandXPENDING, "events", "workers")
+	assert.Equal(t, int64(1), resp.Array[0].Integer)
+	assert.Equal(t, "2-0", resp.Array[1].String)
+	assert.Equal(t, "2-0", resp.Array[2].String)
+	assert.Equal(t, "alice", resp.Array[3].Array[0].Array[0].String)
+	assert.Equal(t, "1", resp.Array[3].Array[0].Array[1].String)
+}
+
+func TestXReadGroupCommand_NoGroup(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "1")
+
+	resp := execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "STREAMS", "events", ">")
+	assert.Equal(t, "NOGROUP No such key 'events' or consumer group 'workers' in XREADGROUP with GROUP option", resp.String)
+}
+
+func TestXPendingCommand_Extended(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "1")
+	xAdd("events", "2-0", "n", "2")
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "COUNT", "1", "STREAMS", "events", ">")
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "bob", "STREAMS", "events", ">")
+
+	resp := execute(NewXPendingCommand, CommandXPENDING, "events", "workers", "-", "+", "10")
+	assert.Len(t, resp.Array, 2)
+	assert.Equal(t, "1-0", resp.Array[0].Array[0].String)
+	assert.Equal(t, "alice", resp.Array[0].Array[1].String)
+	assert.Equal(t, int64(1), resp.Array[0].Array[3].Integer)
+
+	resp = execute(NewXPendingCommand, CommandXPENDING, "events", "workers", "-", "+", "10", "bob")
+	assert.Len(t, resp.Array, 1)
+	assert.Equal(t, "2-0", resp.Array[0].Array[0].String)
+
+	resp = execute(NewXPendingCommand, CommandXPENDING, "events", "workers", "IDLE", "60000", "-", "+", "10")
+	assert.Len(t, resp.Array, 0)
+}
+
+func TestXClaimCommand(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "1")
+	xAdd("events", "2-0", "n", "2")
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "STREAMS", "events", ">")
+
+	// not idle long enough
+	resp := execute(NewXClaimCommand, CommandXCLAIM, "events", "workers", "bob", "60000", "1-0")
+	assert.Len(t, resp.Array, 0)
+
+	resp = execute(NewXClaimCommand, CommandXCLAIM, "events", "workers", "bob", "0", "1-0", "RETRYCOUNT", "5")
+	assert.Equal(t, []string{"1-0"}, entryIDs(resp))
+
+	resp = execute(NewXPendingCommand, CommandXPENDING, "events", "workers", "-", "+", "10", "bob")
+	assert.Len(t, resp.Array, 1)
+	assert.Equal(t, int64(5), resp.Array[0].Array[3].Integer)
+
+	resp = execute(NewXClaimCommand, CommandXCLAIM, "events", "workers", "bob", "0", "2-0", "JUSTID")
+	assert.Equal(t, RESPValue{Type: BulkString, String: "2-0"}, resp.Array[0])
+
+	resp = execute(NewXPendingCommand, CommandXPENDING, "events", "workers", "-", "+", "10", "alice")
+	assert.Len(t, resp.Array, 0)
+}
+
+func TestXAutoClaimCommand(t *testing.T) {
+	ResetStore()
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		xAdd("events", id, "n", id)
+	}
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "STREAMS", "events", ">")
+
+	resp := execute(NewXAutoClaimCommand, CommandXAUTOCLAIM, "events", "workers", "bob", "0", "0", "COUNT", "2")
+	assert.Equal(t, "3-0", resp.Array[0].String)
+	assert.Equal(t, []string{"1-0", "2-0"}, entryIDs(resp.Array[1]))
+	assert.Len(t, resp.Array[2].Array, 0)
+
+	resp = execute(NewXAutoClaimCommand, CommandXAUTOCLAIM, "events", "workers", "bob", "0", resp.Array[0].String, "JUSTID")
+	assert.Equal(t, "0-0", resp.Array[0].String)
+	assert.Equal(t, "3-0", resp.Array[1].Array[0].String)
+
+	resp = execute(NewXPendingCommand, CommandXPENDING, "events", "workers")
+	assert.Equal(t, "bob", resp.Array[3].Array[0].Array[0].String)
+	assert.Equal(t, "3", resp.Array[3].Array[0].Array[1].String)
+}
+
+func TestStreamGroupCommands_PropagateDeterministically(t *testing.T) {
+	setup := func() {
+		ResetStore()
+		xAdd("events", "1-0", "n", "1")
+		xAdd("events", "2-0", "n", "2")
+		execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	}
+	propagate := func(args ...string) []RESPValue {
+		original := RESPValue{Type: Array, Array: bulkArgs(args...)}
+		cmd, err := ParseRESPCommandFromArray(original.Array)
+		assert.NoError(t, err)
+		cmd.Execute(CommandContext{})
+		assert.True(t, cmd.(WriteCommand).ShouldReplicate())
+		return propagatedValues(cmd, original)
+	}
+	groupState := func() []any {
+		s, _ := getStream("events")
+		lastID, entriesRead, _ := s.GroupPosition("workers")
+		state := []any{lastID, entriesRead}
+		for _, id := range []string{"1-0", "2-0"} {
+			streamID, _ := parseStrictStreamID(id)
+			pendingEntry, _ := s.Pending("workers", streamID)
+			state = append(state, pendingEntry)
+		}
+		return state
+	}
+
+	setup()
+	var propagated []RESPValue
+	propagated = append(propagated, propagate(CommandXREADGROUP, "GROUP", "workers", "alice", "BLOCK", "100", "STREAMS", "events", ">")...)
+	propagated = append(propagated, propagate(CommandXCLAIM, "events", "workers", "bob", "0", "1-0", "IDLE", "5000")...)
+	master := groupState()
+
+	assert.Equal(t, []string{CommandXCLAIM, CommandXCLAIM, CommandXGROUP, CommandXCLAIM}, commandNames(propagated))
+	for _, value := range propagated {
+		for _, arg := range value.Array {
+			assert.NotContains(t, []string{"BLOCK", "IDLE"}, arg.String)
+		}
+	}
+
+	// a replica applying the stream later ends up in the same state
+	time.Sleep(5 * time.Millisecond)
+	setup()
+	for _, value := range propagated {
+		cmd, err := ParseRESPCommandFromArray(value.Array)
+		assert.NoError(t, err)
+		assert.NotEqual(t, Error, cmd.Execute(CommandContext{}).Type)
+	}
+	assert.Equal(t, master, groupState())
+}
+
+func TestXClaimCommand_NothingClaimedIsNotReplicated(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "1")
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "STREAMS", "events", ">")
+
+	cmd := NewXClaimCommand(bulkArgs(CommandXCLAIM, "events", "workers", "bob", "60000", "1-0"))
+	cmd.Execute(CommandContext{})
+	assert.False(t, cmd.(WriteCommand).ShouldReplicate())
+}
+
+func commandNames(values []RESPValue) []string {
+	names := make([]string, 0, len(values))
+	for _, value := range values {
+		names = append(names, value.Array[0].String)
+	}
+	return names
+}
+
+func TestXGroupAndXAck_ReplicatedOnlyWhenTheyChangeAGroup(t *testing.T) {
+	ResetStore()
+	xAdd("events", "1-0", "n", "1")
+
+	shouldReplicate := func(factory CommandFactory, args ...string) bool {
+		cmd := factory(bulkArgs(args...))
+		cmd.Execute(CommandContext{})
+		return cmd.(WriteCommand).ShouldReplicate()
+	}
+
+	assert.True(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0"))
+	assert.False(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0"))
+	assert.False(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "CREATE", "other", "workers", "bad", "MKSTREAM"))
+	_, status := store.Get("other", StreamEntryType)
+	assert.Equal(t, NotFound, status)
+
+	assert.True(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "CREATECONSUMER", "events", "workers", "alice"))
+	assert.False(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "CREATECONSUMER", "events", "workers", "alice"))
+	assert.False(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "SETID", "events", "missing", "0"))
+
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "STREAMS", "events", ">")
+	assert.False(t, shouldReplicate(NewXAckCommand, CommandXACK, "events", "workers", "9-0"))
+	assert.True(t, shouldReplicate(NewXAckCommand, CommandXACK, "events", "workers", "1-0"))
+
+	assert.True(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "DELCONSUMER", "events", "workers", "alice"))
+	assert.False(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "DELCONSUMER", "events", "workers", "alice"))
+	assert.True(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "DESTROY", "events", "workers"))
+	assert.False(t, shouldReplicate(NewXGroupCommand, CommandXGROUP, "DESTROY", "events", "workers"))
+}
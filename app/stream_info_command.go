@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+)
+
+type XInfoCommand struct {
+	values []RESPValue
+}
+
+func (xInfo *XInfoCommand) Name() string      { return CommandXINFO }
+func (xInfo *XInfoCommand) Args() []RESPValue { return xInfo.values[1:] }
+
+/** XINFO STREAM key [FULL [COUNT count]] | XINFO GROUPS key | XINFO CONSUMERS key group*/
+func (xInfo *XInfoCommand) Execute(ctx CommandContext) RESPValue {
+	args := xInfo.Args()
+	if len(args) < 2 {
+		return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xinfo' command"}
+	}
+
+	subCmd := strings.ToUpper(args[0].String)
+	key := args[1].String
+
+	s, err := getStream(key)
+	if err != nil {
+		return RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil {
+		return RESPValue{Type: Error, String: "ERR no such key"}
+	}
+
+	switch subCmd {
+	case "STREAM":
+		full, count := false, 10
+		for i := 2; i < len(args); i++ {
+			switch strings.ToUpper(args[i].String) {
+			case "FULL":
+				full = true
+			case "COUNT":
+				if !full || i+1 >= len(args) {
+					return RESPValue{Type: Error, String: "ERR syntax error"}
+				}
+				count, err = strconv.Atoi(args[i+1].String)
+				if err != nil || count < 0 {
+					return RESPValue{Type: Error, String: "ERR value is not an integer or out of range"}
+				}
+				i++
+			default:
+				return RESPValue{Type: Error, String: "ERR syntax error"}
+			}
+		}
+		return streamInfoToRESP(s.Info(full, count), full)
+
+	case "GROUPS":
+		if len(args) != 2 {
+			return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xinfo|groups' command"}
+		}
+		groups := s.GroupsInfo()
+		result := make([]RESPValue, 0, len(groups))
+		for _, group := range groups {
+			result = append(result, respMap(
+				"name", bulk(group.Name),
+				"consumers", integer(int64(len(group.Consumers))),
+				"pending", integer(int64(group.PelCount)),
+				"last-delivered-id", bulk(group.LastDeliveredID.String()),
+				"entries-read", entriesReadToRESP(group.EntriesRead),
+				"lag", lagToRESP(group),
+			))
+		}
+		return RESPValue{Type: Array, Array: result}
+
+	case "CONSUMERS":
+		if len(args) != 3 {
+			return RESPValue{Type: Error, String: "ERR wrong number of arguments for 'xinfo|consumers' command"}
+		}
+		consumers, err := s.ConsumersInfo(args[2].String)
+		if errors.Is(err, stream.ErrNoGroup) {
+			return RESPValue{Type: Error, String: fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", args[2].String, key)}
+		}
+
+		now := currentTimeMillis()
+		result := make([]RESPValue, 0, len(consumers))
+		for _, consumer := range consumers {
+			inactive := int64(-1)
+			if consumer.ActiveTime >= 0 {
+				inactive = now - consumer.ActiveTime
+			}
+			result = append(result, respMap(
+				"name", bulk(consumer.Name),
+				"pending", integer(int64(consumer.PelCount)),
+				"idle", integer(now-consumer.SeenTime),
+				"inactive", integer(inactive),
+			))
+		}
+		return RESPValue{Type: Array, Array: result}
+	}
+
+	return RESPValue{Type: Error, String: fmt.Sprintf("ERR unknown subcommand '%s'. Try XINFO HELP.", args[0].String)}
+}
+
+func streamInfoToRESP(info stream.StreamInfo, full bool) RESPValue {
+	fields := []any{
+		"length", integer(int64(info.Length)),
+		"radix-tree-keys", integer(int64(info.RadixTreeKeys)),
+		"radix-tree-nodes", integer(int64(info.RadixTreeNodes)),
+		"last-generated-id", bulk(info.LastGeneratedID.String()),
+		"max-deleted-entry-id", bulk(info.MaxDeletedID.String()),
+		"entries-added", integer(info.EntriesAdded),
+		"recorded-first-entry-id", bulk(info.RecordedFirstID.String()),
+	}
+
+	if !full {
+		fields = append(fields,
+			"groups", integer(int64(info.GroupCount)),
+			"first-entry", optionalEntryToRESP(info.FirstEntry),
+			"last-entry", optionalEntryToRESP(info.LastEntry),
+		)
+		return respMap(fields...)
+	}
+
+	groups := make([]RESPValue, 0, len(info.Groups))
+	for _, group := range info.Groups {
+		pending := make([]RESPValue, 0, len(group.Pending))
+		for _, pendingEntry := range group.Pending {
+			pending = append(pending, RESPValue{Type: Array, Array: []RESPValue{
+				bulk(pendingEntry.ID.String()),
+				bulk(pendingEntry.Consumer),
+				integer(pendingEntry.DeliveryTime),
+				integer(pendingEntry.DeliveryCount),
+			}})
+		}
+
+		consumers := make([]RESPValue, 0, len(group.Consumers))
+		for _, consumer := range group.Consumers {
+			consumerPending := make([]RESPValue, 0, len(consumer.Pending))
+			for _, pendingEntry := range consumer.Pending {
+				consumerPending = append(consumerPending, RESPValue{Type: Array, Array: []RESPValue{
+					bulk(pendingEntry.ID.String()),
+					integer(pendingEntry.DeliveryTime),
+					integer(pendingEntry.DeliveryCount),
+				}})
+			}
+			consumers = append(consumers, respMap(
+				"name", bulk(consumer.Name),
+				"seen-time", integer(consumer.SeenTime),
+				"active-time", integer(consumer.ActiveTime),
+				"pel-count", integer(int64(consumer.PelCount)),
+				"pending", RESPValue{Type: Array, Array: consumerPending},
+			))
+		}
+
+		groups = append(groups, respMap(
+			"name", bulk(group.Name),
+			"last-delivered-id", bulk(group.LastDeliveredID.String()),
+			"entries-read", entriesReadToRESP(group.EntriesRead),
+			"lag", lagToRESP(group),
+			"pel-count", integer(int64(group.PelCount)),
+			"pending", RESPValue{Type: Array, Array: pending},
+			"consumers", RESPValue{Type: Array, Array: consumers},
+		))
+	}
+
+	fields = append(fields,
+		"entries", streamEntriesToRESP(info.Entries),
+		"groups", RESPValue{Type: Array, Array: groups},
+	)
+	return respMap(fields...)
+}
+
+func optionalEntryToRESP(entry *stream.StreamEntry) RESPValue {
+	if entry == nil {
+		return RESPValue{Type: BulkString, IsNil: true}
+	}
+	return streamEntryToRESP(*entry)
+}
+
+func entriesReadToRESP(entriesRead int64) RESPValue {
+	if entriesRead == stream.InvalidEntriesRead {
+		return RESPValue{Type: BulkString, IsNil: true}
+	}
+	return integer(entriesRead)
+}
+
+func lagToRESP(group stream.GroupInfo) RESPValue {
+	if !group.LagValid {
+		return RESPValue{Type: BulkString, IsNil: true}
+	}
+	return integer(group.Lag)
+}
+
+/** build a RESP2 map reply, a flat array of alternating string keys and values*/
+func respMap(keyValues ...any) RESPValue {
+	result := make([]RESPValue, 0, len(keyValues))
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		result = append(result, bulk(keyValues[i].(string)), keyValues[i+1].(RESPValue))
+	}
+	return RESPValue{Type: Array, Array: result}
+}
+
+func bulk(value string) RESPValue {
+	return RESPValue{Type: BulkString, String: value}
+}
+
+func bulkStrings(values ...string) []RESPValue {
+	result := make([]RESPValue, 0, len(values))
+	for _, value := range values {
+		result = append(result, bulk(value))
+	}
+	return result
+}
+
+func integer(value int64) RESPValue {
+	return RESPValue{Type: Integer, Integer: value}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+/** turn a RESP2 map reply into a go map for easier assertions*/
+func respMapToGo(resp RESPValue) map[string]RESPValue {
+	result := make(map[string]RESPValue)
+	for i := 0; i+1 < len(resp.Array); i += 2 {
+		result[resp.Array[i].String] = resp.Array[i+1]
+	}
+	return result
+}
+
+func TestXInfoCommand_Stream(t *testing.T) {
+	ResetStore()
+	for _, id := range []string{"1-0", "2-0", "3-0", "4-0"} {
+		xAdd("events", id, "n", id)
+	}
+	execute(NewXDelCommand, CommandXDEL, "events", "2-0")
+	execute(NewXTrimCommand, CommandXTRIM, "events", "MAXLEN", "2")
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+
+	info := respMapToGo(execute(NewXInfoCommand, CommandXINFO, "STREAM", "events"))
+	assert.Equal(t, int64(2), info["length"].Integer)
+	assert.Equal(t, int64(1), info["groups"].Integer)
+	assert.Equal(t, "4-0", info["last-generated-id"].String)
+	assert.Equal(t, "2-0", info["max-deleted-entry-id"].String)
+	assert.Equal(t, int64(4), info["entries-added"].Integer)
+	assert.Equal(t, "3-0", info["recorded-first-entry-id"].String)
+	assert.Equal(t, "3-0", info["first-entry"].Array[0].String)
+	assert.Equal(t, "4-0", info["last-entry"].Array[0].String)
+
+	resp := execute(NewXInfoCommand, CommandXINFO, "STREAM", "missing")
+	assert.Equal(t, "ERR no such key", resp.String)
+}
+
+func TestXInfoCommand_GroupsLag(t *testing.T) {
+	ResetStore()
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		xAdd("events", id, "n", id)
+	}
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "COUNT", "1", "STREAMS", "events", ">")
+
+	groups := execute(NewXInfoCommand, CommandXINFO, "GROUPS", "events")
+	assert.Len(t, groups.Array, 1)
+	group := respMapToGo(groups.Array[0])
+	assert.Equal(t, "workers", group["name"].String)
+	assert.Equal(t, int64(1), group["consumers"].Integer)
+	assert.Equal(t, int64(1), group["pending"].Integer)
+	assert.Equal(t, "1-0", group["last-delivered-id"].String)
+	assert.Equal(t, int64(1), group["entries-read"].Integer)
+	assert.Equal(t, int64(2), group["lag"].Integer)
+
+	// a deleted entry ahead of the group makes the lag unknown
+	execute(NewXDelCommand, CommandXDEL, "events", "2-0")
+	group = respMapToGo(execute(NewXInfoCommand, CommandXINFO, "GROUPS", "events").Array[0])
+	assert.True(t, group["lag"].IsNil)
+
+	consumers := execute(NewXInfoCommand, CommandXINFO, "CONSUMERS", "events", "workers")
+	consumer := respMapToGo(consumers.Array[0])
+	assert.Equal(t, "alice", consumer["name"].String)
+	assert.Equal(t, int64(1), consumer["pending"].Integer)
+}
+
+func TestXInfoCommand_StreamFull(t *testing.T) {
+	ResetStore()
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		xAdd("events", id, "n", id)
+	}
+	execute(NewXGroupCommand, CommandXGROUP, "CREATE", "events", "workers", "0")
+	execute(NewXReadGroupCommand, CommandXREADGROUP, "GROUP", "workers", "alice", "STREAMS", "events", ">")
+
+	info := respMapToGo(execute(NewXInfoCommand, CommandXINFO, "STREAM", "events", "FULL", "COUNT", "2"))
+	assert.Equal(t, []string{"1-0", "2-0"}, entryIDs(info["entries"]))
+
+	group := respMapToGo(info["groups"].Array[0])
+	assert.Equal(t, int64(3), group["pel-count"].Integer)
+	assert.Len(t, group["pending"].Array, 2)
+
+	consumer := respMapToGo(group["consumers"].Array[0])
+	assert.Equal(t, "alice", consumer["name"].String)
+	assert.Equal(t, int64(3), consumer["pel-count"].Integer)
+	assert.Len(t, consumer["pending"].Array, 2)
+}
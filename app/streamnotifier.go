@@ -0,0 +1,115 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+/**
+ * wakes up clients blocked on stream keys (XREAD BLOCK) when new entries are added.
+ * waiters are registered per key and notified by XADD, a notification only means
+ * "something changed", the waiter has to re-check the stream itself.
+ */
+type streamNotifier struct {
+	mu      sync.Mutex
+	waiters map[string]map[*streamWaiter]struct{}
+}
+
+type streamWaiter struct {
+	keys   []string
+	notify chan struct{}
+}
+
+var streamWaiters = &streamNotifier{
+	waiters: make(map[string]map[*streamWaiter]struct{}),
+}
+
+/** register a waiter for all the given keys. the waiter must be released with unregister*/
+func (notifier *streamNotifier) register(keys ...string) *streamWaiter {
+	waiter := &streamWaiter{
+		keys:   keys,
+		notify: make(chan struct{}, 1),
+	}
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	for _, key := range keys {
+		keyWaiters, ok := notifier.waiters[key]
+		if !ok {
+			keyWaiters = make(map[*streamWaiter]struct{})
+			notifier.waiters[key] = keyWaiters
+		}
+		keyWaiters[waiter] = struct{}{}
+	}
+
+	return waiter
+}
+
+func (notifier *streamNotifier) unregister(waiter *streamWaiter) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	for _, key := range waiter.keys {
+		keyWaiters := notifier.waiters[key]
+		delete(keyWaiters, waiter)
+		if len(keyWaiters) == 0 {
+			delete(notifier.waiters, key)
+		}
+	}
+}
+
+/** wake up every waiter registered on key. never blocks, a pending wake up is enough*/
+func (notifier *streamNotifier) signal(key string) {
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	for waiter := range notifier.waiters[key] {
+		select {
+		case waiter.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+/**
+ * run read until it returns a non empty result. when waiter is nil the read is done once,
+ * otherwise it is retried on every notification until block passes (0 blocks forever).
+ * @return the read result, or a nil array when nothing was read in time
+ */
+func waitForStreams(held sync.Locker, waiter *streamWaiter, block time.Duration, read func() ([]RESPValue, error)) RESPValue {
+	var deadline <-chan time.Time
+	if block > 0 {
+		timer := time.NewTimer(block)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	for {
+		result, err := read()
+		if err != nil {
+			return RESPValue{Type: Error, String: err.Error()}
+		}
+		if len(result) > 0 {
+			return RESPValue{Type: Array, Array: result}
+		}
+		if waiter == nil {
+			return RESPValue{Type: Array, Array: nil}
+		}
+
+		// the writes we wait for need the write lock, a blocked write command gives it up meanwhile
+		if held != nil {
+			held.Unlock()
+		}
+		// BLOCK 0 leaves deadline nil, so only a new entry can wake us up
+		var timedOut bool
+		select {
+		case <-waiter.notify:
+		case <-deadline:
+			timedOut = true
+		}
+		if held != nil {
+			held.Lock()
+		}
+		if timedOut {
+			return RESPValue{Type: Array, Array: nil}
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/stream"
+)
+
+/**
+ * return the stream stored under key, creating an empty one if the key doesn't exist.
+ * @return created is true when a new stream was stored by this call
+ */
+func getOrCreateStream(key string) (s *stream.Stream, created bool, err error) {
+	entry, loaded := store.LoadOrStore(key, Entry{
+		Val:  stream.NewStream(),
+		Type: StreamEntryType,
+	})
+
+	if entry.Type != StreamEntryType {
+		return nil, false, errors.New(ErrWrongType)
+	}
+
+	return entry.Val.(*stream.Stream), !loaded, nil
+}
+
+/** return the stream stored under key. a missing key returns a nil stream and no error*/
+func getStream(key string) (*stream.Stream, error) {
+	entry, lookupStatus := store.Get(key, StreamEntryType)
+	switch lookupStatus {
+	case NotFound, Expired:
+		return nil, nil
+	case WrongType:
+		return nil, errors.New(ErrWrongType)
+	}
+
+	return entry.Val.(*stream.Stream), nil
+}
+
+/**
+ * parse a XRANGE/XREVRANGE interval boundary. a "(" prefix makes the boundary exclusive,
+ * which is turned into the closest inclusive id.
+ */
+func parseIntervalID(raw string, missingSeq int64, isStart bool) (stream.StreamID, error) {
+	exclusive := strings.HasPrefix(raw, "(")
+	if !exclusive {
+		return stream.ParseRangeID(raw, missingSeq)
+	}
+
+	raw = raw[1:]
+	if raw == "-" || raw == "+" {
+		return stream.StreamID{}, stream.ErrInvalidID
+	}
+	id, err := stream.ParseRangeID(raw, missingSeq)
+	if err != nil {
+		return stream.StreamID{}, err
+	}
+
+	if isStart {
+		next, ok := id.Next()
+		if !ok {
+			return stream.StreamID{}, errors.New("ERR invalid start ID for the interval")
+		}
+		return next, nil
+	}
+
+	prev, ok := id.Prev()
+	if !ok {
+		return stream.StreamID{}, errors.New("ERR invalid end ID for the interval")
+	}
+	return prev, nil
+}
+
+/** an entry with nil Fields was deleted from the stream and is replied as [id, nil]*/
+func streamEntryToRESP(entry stream.StreamEntry) RESPValue {
+	if entry.Fields == nil {
+		return RESPValue{
+			Type: Array,
+			Array: []RESPValue{
+				{Type: BulkString, String: entry.ID.String()},
+				{Type: Array, Array: nil},
+			},
+		}
+	}
+
+	fields := make([]RESPValue, 0, len(entry.Fields)*2)
+	for _, field := range entry.Fields {
+		fields = append(fields,
+			RESPValue{Type: BulkString, String: field.Name},
+			RESPValue{Type: BulkString, String: field.Value})
+	}
+
+	return RESPValue{
+		Type: Array,
+		Array: []RESPValue{
+			{Type: BulkString, String: entry.ID.String()},
+			{Type: Array, Array: fields},
+		},
+	}
+}
+
+func streamEntriesToRESP(entries []stream.StreamEntry) RESPValue {
+	respEntries := make([]RESPValue, 0, len(entries))
+	for _, entry := range entries {
+		respEntries = append(respEntries, streamEntryToRESP(entry))
+	}
+
+	return RESPValue{Type: Array, Array: respEntries}
+}
+
+/** resolve a XREAD id argument. "$" is the last id of the stream at the time of the call*/
+func resolveXReadID(key, raw string) (stream.StreamID, error) {
+	if raw != "$" {
+		return parseStrictStreamID(raw)
+	}
+
+	s, err := getStream(key)
+	if err != nil {
+		return stream.StreamID{}, err
+	}
+	if s == nil {
+		return stream.MinID, nil
+	}
+	return s.LastID(), nil
+}
+
+/** read the entries added after lastIDs[i] to each of the streams, in the XREAD reply format*/
+func readStreamsAfter(keys []string, lastIDs []stream.StreamID, count int) ([]RESPValue, error) {
+	var result []RESPValue
+	for i, key := range keys {
+		s, err := getStream(key)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			continue
+		}
+
+		start, ok := lastIDs[i].Next()
+		if !ok {
+			continue
+		}
+		entries := s.Range(start, stream.MaxID, count, false)
+		if len(entries) == 0 {
+			continue
+		}
+
+		result = append(result, RESPValue{
+			Type: Array,
+			Array: []RESPValue{
+				{Type: BulkString, String: key},
+				streamEntriesToRESP(entries),
+			},
+		})
+	}
+
+	return result, nil
+}
+
+type streamReadOptions struct {
+	count    int
+	block    time.Duration // negative when BLOCK was not given
+	noAck    bool
+	group    string
+	consumer string
+	keys     []string
+	ids      []string
+}
+
+/** parse the XREAD / XREADGROUP arguments. GROUP and NOACK are only accepted when isGroup is set*/
+func parseStreamReadOptions(args []RESPValue, isGroup bool) (streamReadOptions, error) {
+	commandName, newEntriesID := "xread", "$"
+	if isGroup {
+		commandName, newEntriesID = "xreadgroup", ">"
+	}
+
+	opts := streamReadOptions{block: -1}
+	streamsIdx := -1
+
+	for i := 0; i < len(args) && streamsIdx < 0; i++ {
+		hasValue := i+1 < len(args)
+		switch strings.ToUpper(args[i].String) {
+		case "COUNT":
+			if !hasValue {
+				return opts, errors.New("ERR syntax error")
+			}
+			val, err := strconv.Atoi(args[i+1].String)
+			if err != nil {
+				return opts, errors.New("ERR value is not an integer or out of range")
+			}
+			opts.count = val
+			i++
+		case "BLOCK":
+			if !hasValue {
+				return opts, errors.New("ERR syntax error")
+			}
+			val, err := strconv.ParseInt(args[i+1].String, 10, 64)
+			if err != nil {
+				return opts, errors.New("ERR timeout is not an integer or out of range")
+			}
+			if val < 0 {
+				return opts, errors.New("ERR timeout is negative")
+			}
+			opts.block = time.Duration(val) * time.Millisecond
+			i++
+		case "GROUP":
+			if !isGroup || i+2 >= len(args) {
+				return opts, errors.New("ERR syntax error")
+			}
+			opts.group = args[i+1].String
+			opts.consumer = args[i+2].String
+			i += 2
+		case "NOACK":
+			if !isGroup {
+				return opts, errors.New("ERR syntax error")
+			}
+			opts.noAck = true
+		case "STREAMS":
+			streamsIdx = i + 1
+		default:
+			return opts, errors.New("ERR syntax error")
+		}
+	}
+
+	if streamsIdx < 0 || streamsIdx >= len(args) {
+		return opts, fmt.Errorf("ERR wrong number of arguments for '%s' command", commandName)
+	}
+	if isGroup && opts.group == "" {
+		return opts, errors.New("ERR Missing GROUP option for XREADGROUP")
+	}
+
+	streamArgs := args[streamsIdx:]
+	if len(streamArgs)%2 != 0 {
+		return opts, fmt.Errorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '%s' must be specified.", commandName, newEntriesID)
+	}
+
+	numStreams := len(streamArgs) / 2
+	for i := 0; i < numStreams; i++ {
+		opts.keys = append(opts.keys, streamArgs[i].String)
+		opts.ids = append(opts.ids, streamArgs[numStreams+i].String)
+	}
+
+	return opts, nil
+}
+
+/** parse a complete entry id argument, as used by XACK, XCLAIM and XREADGROUP*/
+func parseStrictStreamID(raw string) (stream.StreamID, error) {
+	id, needAutoSeq, err := stream.ParseStreamID(raw)
+	if err != nil || needAutoSeq {
+		return stream.StreamID{}, stream.ErrInvalidID
+	}
+	return id, nil
+}
+
+/** resolve a group id argument where "$" means the last id of the stream*/
+func parseGroupStreamID(s *stream.Stream, raw string) (stream.StreamID, error) {
+	if raw == "$" {
+		return s.LastID(), nil
+	}
+	return parseStrictStreamID(raw)
+}
+
+func noGroupError(key, group string) RESPValue {
+	return RESPValue{Type: Error, String: fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group)}
+}
+
+/** like getStream, but a missing stream or a missing group are reported as a NOGROUP error*/
+func getStreamWithGroup(key, group string) (*stream.Stream, *RESPValue) {
+	s, err := getStream(key)
+	if err != nil {
+		return nil, &RESPValue{Type: Error, String: err.Error()}
+	}
+	if s == nil || !s.HasGroup(group) {
+		errResp := noGroupError(key, group)
+		return nil, &errResp
+	}
+	return s, nil
+}
+
+func streamIDsToRESP(ids []stream.StreamID) RESPValue {
+	respIDs := make([]RESPValue, 0, len(ids))
+	for _, id := range ids {
+		respIDs = append(respIDs, RESPValue{Type: BulkString, String: id.String()})
+	}
+	return RESPValue{Type: Array, Array: respIDs}
+}
+
+func currentTimeMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+/**
+ * parse the trimming options of XADD and XTRIM starting at args[i]:
+ * MAXLEN|MINID [=|~] threshold [LIMIT count]
+ * @return the options and the index of the first argument after them
+ */
+func parseTrimOptions(args []RESPValue, i int) (stream.TrimOptions, int, error) {
+	opts := stream.TrimOptions{}
+	switch strings.ToUpper(args[i].String) {
+	case "MAXLEN":
+		opts.Strategy = stream.TrimMaxLen
+	case "MINID":
+		opts.Strategy = stream.TrimMinID
+	default:
+		return opts, i, errors.New("ERR syntax error")
+	}
+	i++
+
+	if i < len(args) && (args[i].String == "~" || args[i].String == "=") {
+		opts.Approx = args[i].String == "~"
+		i++
+	}
+	if i >= len(args) {
+		return opts, i, errors.New("ERR syntax error")
+	}
+
+	if opts.Strategy == stream.TrimMaxLen {
+		maxLen, err := strconv.ParseInt(args[i].String, 10, 64)
+		if err != nil {
+			return opts, i, errors.New("ERR value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return opts, i, errors.New("ERR The MAXLEN argument must be >= 0.")
+		}
+		opts.MaxLen = maxLen
+	} else {
+		minID, err := stream.ParseRangeID(args[i].String, 0)
+		if err != nil {
+			return opts, i, err
+		}
+		opts.MinID = minID
+	}
+	i++
+
+	if opts.Approx {
+		opts.Limit = 100 * stream.NodeMaxEntries
+	}
+	if i+1 < len(args) && strings.ToUpper(args[i].String) == "LIMIT" {
+		limit, err := strconv.ParseInt(args[i+1].String, 10, 64)
+		if err != nil {
+			return opts, i, errors.New("ERR value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return opts, i, errors.New("ERR The LIMIT argument must be >= 0.")
+		}
+		if !opts.Approx {
+			return opts, i, errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		opts.Limit = limit
+		i += 2
+	}
+
+	return opts, i, nil
+}
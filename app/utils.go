@@ -6,36 +6,40 @@ import (
 	"io"
 	"log"
 	"net"
-	"os"
+	"strconv"
 	"strings"
+	"sync"
 )
 
-var flagCache = make(map[string]string)
+var (
+	flagsMu sync.RWMutex
+	// --name value pairs from the command line, parsed once at startup
+	flags = map[string]string{}
+)
 
-func GetFlagValue(flagName string) (string, bool) {
-	if !strings.HasPrefix(flagName, "--") {
-		flagName = "--" + flagName
+/** parse the command line into flags. GetFlagValue only reads the result, so lookups are cheap and safe to share*/
+func parseFlags(args []string) {
+	parsed := make(map[string]string)
+	for i := 1; i+1 < len(args); i++ {
+		if _, seen := parsed[args[i]]; strings.HasPrefix(args[i], "--") && !seen {
+			parsed[args[i]] = args[i+1]
+		}
 	}
 
-	// Check cache first
-	if val, ok := flagCache[flagName]; ok {
-		log.Printf("flag [%s] = %s (cached)\n", flagName, val)
-		return val, true
-	}
+	flagsMu.Lock()
+	defer flagsMu.Unlock()
+	flags = parsed
+}
 
-	// Search os.Args
-	args := os.Args
-	for i, arg := range args {
-		if arg == flagName && i+1 < len(args) {
-			val := args[i+1]
-			flagCache[flagName] = val
-			log.Printf("flag [%s] = %s (parsed and cached)\n", flagName, val)
-			return val, true
-		}
+func GetFlagValue(flagName string) (string, bool) {
+	if !strings.HasPrefix(flagName, "--") {
+		flagName = "--" + flagName
 	}
 
-	log.Printf("flag [%s] not found\n", flagName)
-	return "", false
+	flagsMu.RLock()
+	defer flagsMu.RUnlock()
+	val, ok := flags[flagName]
+	return val, ok
 }
 
 const (
@@ -43,6 +47,8 @@ const (
 	FlagDbFilename = "--dbfilename"
 	FlagPort       = "--port"
 	FlagReplicaof  = "--replicaof"
+
+	FlagRdbSkipZeroChecksum = "--rdb-skip-zero-checksum"
 )
 
 const PORT_DEFUALT = "6379"
@@ -78,19 +84,38 @@ func sendReplConf(conn net.Conn, key, value string) error {
 	return nil
 }
 
-func sendPsync(conn net.Conn) error {
-	psyncCmd := "*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n"
+/** the master's answer to PSYNC. replID is empty for a bare +CONTINUE from a master that keeps its id*/
+type psyncReply struct {
+	fullResync bool
+	replID     string
+	offset     int64
+}
+
+/** send PSYNC <replID> <offset>, "? -1" asks for a full resync*/
+func sendPsync(conn net.Conn, replID, offset string) (psyncReply, error) {
+	psyncCmd := fmt.Sprintf("*3\r\n$5\r\nPSYNC\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(replID), replID, len(offset), offset)
 	if _, err := conn.Write([]byte(psyncCmd)); err != nil {
-		return err
+		return psyncReply{}, err
 	}
 	resp, err := readLine(conn)
 	if err != nil {
-		return err
+		return psyncReply{}, err
 	}
-	if !strings.HasPrefix(resp, "+FULLRESYNC") {
-		return fmt.Errorf("unexpected PSYNC response: %q", resp)
+
+	fields := strings.Fields(resp)
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		masterOffset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return psyncReply{}, fmt.Errorf("invalid FULLRESYNC offset: %q", resp)
+		}
+		return psyncReply{fullResync: true, replID: fields[1], offset: masterOffset}, nil
+	case len(fields) == 1 && fields[0] == "+CONTINUE":
+		return psyncReply{}, nil
+	case len(fields) == 2 && fields[0] == "+CONTINUE":
+		return psyncReply{replID: fields[1]}, nil
 	}
-	return nil
+	return psyncReply{}, fmt.Errorf("unexpected PSYNC response: %q", resp)
 }
 
 func readLine(conn net.Conn) (string, error) {
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+)
+
+const (
+	ziplistHeaderSize = 10
+	ziplistEnd        = 0xFF
+	ziplistBigPrevLen = 0xFE
+
+	intsetHeaderSize = 8
+
+	zipmapBigLen = 0xFE
+	zipmapEnd    = 0xFF
+)
+
+/**
+ * decode a ziplist blob (the pre 7.0 compact encoding of lists, hashes and zsets).
+ * integer elements are returned in their decimal string form.
+ * https://github.com/redis/redis/blob/6.2/src/ziplist.c
+ */
+func decodeZiplist(data []byte) ([]string, error) {
+	if len(data) < ziplistHeaderSize+1 {
+		return nil, fmt.Errorf("ziplist too short: %d bytes", len(data))
+	}
+
+	totalBytes := int(binary.LittleEndian.Uint32(data[0:4]))
+	if totalBytes != len(data) {
+		return nil, fmt.Errorf("ziplist size mismatch: header %d, actual %d", totalBytes, len(data))
+	}
+
+	var elements []string
+	pos := ziplistHeaderSize
+	for {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("ziplist is missing its end marker")
+		}
+		if data[pos] == ziplistEnd {
+			return elements, nil
+		}
+
+		// the previous entry length is only needed for backwards traversal
+		if data[pos] == ziplistBigPrevLen {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(data) {
+			return nil, fmt.Errorf("ziplist entry truncated")
+		}
+
+		value, entryLen, err := decodeZiplistEntry(data[pos:])
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, value)
+		pos += entryLen
+	}
+}
+
+/**
+ * decode the encoding and data of a single ziplist entry.
+ * @return the element and the number of bytes it occupies
+ */
+func decodeZiplistEntry(data []byte) (string, int, error) {
+	need := func(n int) error {
+		if len(data) < n {
+			return fmt.Errorf("ziplist entry truncated")
+		}
+		return nil
+	}
+
+	b := data[0]
+	switch {
+	case b>>6 == 0: // 6 bit string length
+		length := int(b & 0x3F)
+		if err := need(1 + length); err != nil {
+			return "", 0, err
+		}
+		return string(data[1 : 1+length]), 1 + length, nil
+
+	case b>>6 == 1: // 14 bit string length
+		if err := need(2); err != nil {
+			return "", 0, err
+		}
+		length := int(b&0x3F)<<8 | int(data[1])
+		if err := need(2 + length); err != nil {
+			return "", 0, err
+		}
+		return string(data[2 : 2+length]), 2 + length, nil
+
+	case b == 0x80: // 32 bit string length
+		if err := need(5); err != nil {
+			return "", 0, err
+		}
+		length := int(binary.BigEndian.Uint32(data[1:5]))
+		if err := need(5 + length); err != nil {
+			return "", 0, err
+		}
+		return string(data[5 : 5+length]), 5 + length, nil
+
+	case b == 0xC0: // int16
+		if err := need(3); err != nil {
+			return "", 0, err
+		}
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(data[1:3])))), 3, nil
+
+	case b == 0xD0: // int32
+		if err := need(5); err != nil {
+			return "", 0, err
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(data[1:5])))), 5, nil
+
+	case b == 0xE0: // int64
+		if err := need(9); err != nil {
+			return "", 0, err
+		}
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(data[1:9])), 10), 9, nil
+
+	case b == 0xF0: // int24
+		if err := need(4); err != nil {
+			return "", 0, err
+		}
+		uv := int32(data[1]) | int32(data[2])<<8 | int32(data[3])<<16
+		// sign extend from 24 bits
+		return strconv.Itoa(int(uv << 8 >> 8)), 4, nil
+
+	case b == 0xFE: // int8
+		if err := need(2); err != nil {
+			return "", 0, err
+		}
+		return strconv.Itoa(int(int8(data[1]))), 2, nil
+
+	case b >= 0xF1 && b <= 0xFD: // 4 bit immediate, stored as value+1
+		return strconv.Itoa(int(b&0x0F) - 1), 1, nil
+	}
+
+	return "", 0, fmt.Errorf("unknown ziplist entry encoding: 0x%02X", b)
+}
+
+/**
+ * decode an intset blob: a sorted array of little endian integers of 2, 4 or 8 bytes each.
+ * https://github.com/redis/redis/blob/unstable/src/intset.c
+ */
+func decodeIntset(data []byte) ([]string, error) {
+	if len(data) < intsetHeaderSize {
+		return nil, fmt.Errorf("intset too short: %d bytes", len(data))
+	}
+
+	width := int(binary.LittleEndian.Uint32(data[0:4]))
+	length := int(binary.LittleEndian.Uint32(data[4:8]))
+	if width != 2 && width != 4 && width != 8 {
+		return nil, fmt.Errorf("invalid intset encoding: %d", width)
+	}
+	if len(data) != intsetHeaderSize+width*length {
+		return nil, fmt.Errorf("intset size mismatch: %d elements of %d bytes in %d bytes", length, width, len(data))
+	}
+
+	members := make([]string, 0, length)
+	for i := 0; i < length; i++ {
+		raw := data[intsetHeaderSize+i*width:]
+		var val int64
+		switch width {
+		case 2:
+			val = int64(int16(binary.LittleEndian.Uint16(raw)))
+		case 4:
+			val = int64(int32(binary.LittleEndian.Uint32(raw)))
+		case 8:
+			val = int64(binary.LittleEndian.Uint64(raw))
+		}
+		members = append(members, strconv.FormatInt(val, 10))
+	}
+	return members, nil
+}
+
+/**
+ * decode a zipmap blob (the pre 2.6 compact hash encoding) into alternating fields and values.
+ * https://github.com/redis/redis/blob/6.2/src/zipmap.c
+ */
+func decodeZipmap(data []byte) ([]string, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("zipmap too short: %d bytes", len(data))
+	}
+
+	pos := 1 // the first byte is the (possibly saturated) number of pairs
+	readLen := func() (int, error) {
+		if pos >= len(data) {
+			return 0, fmt.Errorf("zipmap truncated")
+		}
+		b := data[pos]
+		if b < zipmapBigLen {
+			pos++
+			return int(b), nil
+		}
+		if pos+5 > len(data) {
+			return 0, fmt.Errorf("zipmap truncated")
+		}
+		length := int(binary.LittleEndian.Uint32(data[pos+1 : pos+5]))
+		pos += 5
+		return length, nil
+	}
+	readBytes := func(n int) (string, error) {
+		if pos+n > len(data) {
+			return "", fmt.Errorf("zipmap truncated")
+		}
+		s := string(data[pos : pos+n])
+		pos += n
+		return s, nil
+	}
+
+	var elements []string
+	for {
+		if pos >= len(data) {
+			return nil, fmt.Errorf("zipmap is missing its end marker")
+		}
+		if data[pos] == zipmapEnd {
+			return elements, nil
+		}
+
+		keyLen, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		key, err := readBytes(keyLen)
+		if err != nil {
+			return nil, err
+		}
+		valueLen, err := readLen()
+		if err != nil {
+			return nil, err
+		}
+		if pos >= len(data) {
+			return nil, fmt.Errorf("zipmap truncated")
+		}
+		free := int(data[pos])
+		pos++
+		value, err := readBytes(valueLen)
+		if err != nil {
+			return nil, err
+		}
+		// values may be followed by unused bytes left over from in place updates
+		if _, err := readBytes(free); err != nil {
+			return nil, err
+		}
+		elements = append(elements, key, value)
+	}
+}
@@ -2,6 +2,12 @@ module github.com/codecrafters-io/redis-starter-go
 
 go 1.24.0
 
+require (
+	github.com/plar/go-adaptive-radix-tree v1.0.7
+	github.com/stretchr/testify v1.10.0
+	github.com/taroim/rdb v0.0.0-20230411080031-693156fc3e2f
+)
+
 require (
 	github.com/bytedance/sonic v1.12.1 // indirect
 	github.com/bytedance/sonic/loader v0.2.0 // indirect
@@ -10,10 +16,7 @@ require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/hdt3213/rdb v1.1.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.8 // indirect
-	github.com/plar/go-adaptive-radix-tree v1.0.7 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/stretchr/testify v1.10.0 // indirect
-	github.com/taroim/rdb v0.0.0-20230411080031-693156fc3e2f // indirect
 	github.com/twitchyliquid64/golang-asm v0.15.1 // indirect
 	golang.org/x/arch v0.9.0 // indirect
 	golang.org/x/sys v0.24.0 // indirect